@@ -0,0 +1,181 @@
+// Package admin serves the operational endpoints on a listener kept off the public API.
+package admin
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+
+	"github.com/UArt-project/UArt-proxy/pkg/cache"
+	"github.com/UArt-project/UArt-proxy/pkg/healthcheck"
+	"github.com/UArt-project/UArt-proxy/pkg/jsonoperations"
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/maintenance"
+	"github.com/UArt-project/UArt-proxy/pkg/metrics"
+	"github.com/UArt-project/UArt-proxy/pkg/probe"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
+	"github.com/gorilla/mux"
+)
+
+// API is responsible for handling the operational requests.
+type API struct {
+	// Logger.
+	loggr *logger.Logger
+	// Router.
+	router *mux.Router
+	// The upstream health checker.
+	healthChecker *healthcheck.Checker
+	// The liveness and readiness probe.
+	probe *probe.Probe
+	// The upstream registry.
+	upstreams *upstream.Registry
+	// The build of the running binary.
+	buildInfo BuildInfo
+	// Returns the settings of the config in use.
+	settings func() map[string]any
+	// The market cache.
+	appCache *cache.LocalCache
+	// The maintenance mode of the public routes.
+	maintenance *maintenance.Mode
+	// The names of the public routes the maintenance can be toggled for.
+	routes map[string]bool
+	// The bearer tokens of the management endpoints by the name of their holder.
+	tokens atomic.Pointer[map[string]string]
+	// Logs the management requests.
+	auditLogger *logger.Logger
+}
+
+// NewAPI creates a new instance of the API, the authenticated requests are audit-logged to the audit logger.
+func NewAPI(loggr, auditLogger *logger.Logger) *API {
+	router := mux.NewRouter()
+
+	api := &API{
+		loggr:       loggr,
+		router:      router,
+		auditLogger: auditLogger,
+	}
+
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		problem.Write(w, req, http.StatusNotFound, "the resource doesn't exist")
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		problem.Write(w, req, http.StatusMethodNotAllowed, "the method isn't allowed for the resource")
+	})
+
+	return api
+}
+
+// RegisterProbe exposes the liveness and readiness reports of the probe.
+func (a *API) RegisterProbe(appProbe *probe.Probe) {
+	a.probe = appProbe
+
+	a.router.HandleFunc("/healthz", a.getLiveness).Methods(http.MethodGet)
+	a.router.HandleFunc("/readyz", a.getReadiness).Methods(http.MethodGet)
+}
+
+// RegisterHealthChecker sets the checker of the upstream health status exposed by the management endpoints.
+func (a *API) RegisterHealthChecker(checker *healthcheck.Checker) {
+	a.healthChecker = checker
+}
+
+// RegisterUpstreams sets the upstream registry managed and exposed by the management endpoints.
+func (a *API) RegisterUpstreams(registry *upstream.Registry) {
+	a.upstreams = registry
+}
+
+// RegisterMetrics exposes the metrics of the registry.
+func (a *API) RegisterMetrics(reg *metrics.Registry) {
+	a.router.Handle("/metrics", reg).Methods(http.MethodGet)
+}
+
+// RegisterProfiler exposes the runtime profiles of net/http/pprof under /debug/pprof/.
+// The requests are authenticated with the bearer tokens set with SetTokens, the profiles expose the memory.
+func (a *API) RegisterProfiler() {
+	profiler := a.router.PathPrefix("/debug/pprof").Subrouter()
+	profiler.Use(a.auditMiddleware, a.authMiddleware)
+
+	profiler.HandleFunc("/cmdline", pprof.Cmdline).Name("pprof.cmdline")
+	profiler.HandleFunc("/profile", pprof.Profile).Name("pprof.profile")
+	profiler.HandleFunc("/symbol", pprof.Symbol).Name("pprof.symbol")
+	profiler.HandleFunc("/trace", pprof.Trace).Name("pprof.trace")
+	profiler.PathPrefix("/").HandlerFunc(pprof.Index).Name("pprof.index")
+}
+
+// RegisterBuildInfo exposes the build of the running binary with the specified version.
+func (a *API) RegisterBuildInfo(version string) {
+	a.buildInfo = ReadBuildInfo(version)
+
+	a.router.HandleFunc("/buildinfo", a.getBuildInfo).Methods(http.MethodGet)
+}
+
+// RegisterConfig exposes the settings returned by the function with the secrets redacted.
+// The function is called on every request, so the dump follows the config reloads.
+// The requests are authenticated with the bearer tokens set with SetTokens.
+func (a *API) RegisterConfig(settings func() map[string]any) {
+	a.settings = settings
+
+	a.router.Handle("/config", a.auditMiddleware(a.authMiddleware(http.HandlerFunc(a.getConfig)))).
+		Methods(http.MethodGet).Name("config.get")
+}
+
+// ServeHTTP handles the operational requests.
+func (a *API) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a.router.ServeHTTP(w, req)
+}
+
+// getLiveness handles the request for checking whether the process is up.
+func (a *API) getLiveness(responseWriter http.ResponseWriter, req *http.Request) {
+	a.writeJSON(responseWriter, req, http.StatusOK, a.probe.Liveness())
+}
+
+// getReadiness handles the request for checking whether the application can serve traffic.
+func (a *API) getReadiness(responseWriter http.ResponseWriter, req *http.Request) {
+	report, ready := a.probe.Readiness(req.Context())
+	if !ready {
+		a.writeJSON(responseWriter, req, http.StatusServiceUnavailable, report)
+
+		return
+	}
+
+	a.writeJSON(responseWriter, req, http.StatusOK, report)
+}
+
+// getUpstreams handles the request for getting the health status of the upstreams.
+func (a *API) getUpstreams(responseWriter http.ResponseWriter, req *http.Request) {
+	a.writeJSON(responseWriter, req, http.StatusOK, a.healthChecker.Status())
+}
+
+// getUpstreamConnections handles the request for getting the connection pool statistics.
+func (a *API) getUpstreamConnections(responseWriter http.ResponseWriter, req *http.Request) {
+	a.writeJSON(responseWriter, req, http.StatusOK, a.upstreams.Stats())
+}
+
+// getBuildInfo handles the request for getting the build of the running binary.
+func (a *API) getBuildInfo(responseWriter http.ResponseWriter, req *http.Request) {
+	a.writeJSON(responseWriter, req, http.StatusOK, a.buildInfo)
+}
+
+// getConfig handles the request for getting the config in use with the secrets redacted.
+func (a *API) getConfig(responseWriter http.ResponseWriter, req *http.Request) {
+	a.writeJSON(responseWriter, req, http.StatusOK, Redact(a.settings()))
+}
+
+// writeJSON encodes the data and writes it to the response with the status.
+func (a *API) writeJSON(responseWriter http.ResponseWriter, req *http.Request, status int, data any) {
+	encData, err := jsonoperations.Encode(data)
+	if err != nil {
+		a.loggr.WithContext(req.Context()).Error("encoding the response body: %v", err)
+		problem.Write(responseWriter, req, http.StatusInternalServerError, "the response couldn't be encoded")
+
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(status)
+
+	_, err = responseWriter.Write(encData)
+	if err != nil {
+		a.loggr.WithContext(req.Context()).Error("writing the response body: %v", err)
+	}
+}
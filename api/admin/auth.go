@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/UArt-project/UArt-proxy/pkg/httpx"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+	"github.com/gorilla/mux"
+)
+
+// auditKey is the context key of the audit record of the request.
+type auditKey struct{}
+
+// auditRecord is filled in while the management request is handled and logged once it's done.
+type auditRecord struct {
+	// The name of the token holder, empty until the request is authenticated.
+	actor string
+	// The details of the action, e.g. the new value.
+	detail string
+}
+
+// SetTokens replaces the bearer tokens of the management endpoints by the name of their holder.
+// It can be called while serving, no request is authenticated while there is no token.
+func (a *API) SetTokens(tokens map[string]string) {
+	copied := make(map[string]string, len(tokens))
+	for name, token := range tokens {
+		copied[name] = token
+	}
+
+	a.tokens.Store(&copied)
+}
+
+// authenticate returns the name of the holder of the bearer token of the request.
+func (a *API) authenticate(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	tokens := a.tokens.Load()
+	if tokens == nil {
+		return "", false
+	}
+
+	for name, expected := range *tokens {
+		if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// authMiddleware rejects the requests without a valid bearer token.
+func (a *API) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		actor, ok := a.authenticate(req)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			problem.Write(w, req, http.StatusUnauthorized, "a valid bearer token is required")
+
+			return
+		}
+
+		if record, ok := req.Context().Value(auditKey{}).(*auditRecord); ok {
+			record.actor = actor
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// auditMiddleware logs every authenticated request with its holder, action, details and status,
+// the rejected ones included.
+func (a *API) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		record := new(auditRecord)
+		recorder := httpx.NewRecorder(w)
+
+		next.ServeHTTP(recorder, req.WithContext(context.WithValue(req.Context(), auditKey{}, record)))
+
+		action := "unknown"
+		if route := mux.CurrentRoute(req); route != nil && route.GetName() != "" {
+			action = route.GetName()
+		}
+
+		actor := record.actor
+		if actor == "" {
+			actor = "-"
+		}
+
+		a.auditLogger.WithContext(req.Context()).Audit("actor=%s action=%s path=%q detail=%q status=%d remote=%s",
+			actor, action, req.URL.Path, record.detail, recorder.Status(), req.RemoteAddr)
+	})
+}
+
+// setAuditDetail records the details of the action in the audit record of the request.
+func setAuditDetail(req *http.Request, format string, args ...any) {
+	if record, ok := req.Context().Value(auditKey{}).(*auditRecord); ok {
+		record.detail = fmt.Sprintf(format, args...)
+	}
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// BuildInfo describes the build of the running binary.
+type BuildInfo struct {
+	// The version set at build time.
+	Version string `json:"version"`
+	// The Go version the binary is built with.
+	GoVersion string `json:"goVersion"`
+	// The main module path.
+	Module string `json:"module,omitempty"`
+	// The VCS revision, its commit time and whether the tree had local changes.
+	Revision string `json:"revision,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+}
+
+// ReadBuildInfo returns the build of the running binary with the specified version.
+// The VCS fields are empty if the binary isn't built from a repository checkout.
+func ReadBuildInfo(version string) BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Module = build.Main.Path
+
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
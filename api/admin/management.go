@@ -0,0 +1,297 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
+	"github.com/UArt-project/UArt-proxy/pkg/cache"
+	"github.com/UArt-project/UArt-proxy/pkg/jsonoperations"
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/maintenance"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+	"github.com/gorilla/mux"
+)
+
+// maxBodySize is the largest accepted management request body.
+const maxBodySize = 64 << 10
+
+// cacheEntryResponse is a cached page in the cache listing.
+type cacheEntryResponse struct {
+	// The number of the page.
+	Page int `json:"page"`
+	// The number of the items of the page.
+	Items int `json:"items"`
+	// The time the page expires at.
+	ExpireAt time.Time `json:"expireAt"`
+}
+
+// cachePageResponse is a cached page with its items.
+type cachePageResponse struct {
+	// The number of the page.
+	Page int `json:"page"`
+	// The time the page expires at.
+	ExpireAt time.Time `json:"expireAt"`
+	// The items of the page.
+	Items []marketdomain.MarketItem `json:"items"`
+}
+
+// purgeResponse reports the number of the purged pages.
+type purgeResponse struct {
+	// The number of the purged pages.
+	Purged int `json:"purged"`
+}
+
+// targetRequest selects a target of an upstream.
+type targetRequest struct {
+	// The url of the target.
+	URL string `json:"url"`
+}
+
+// targetResponse reports the rotation state of a target.
+type targetResponse struct {
+	// The name of the upstream.
+	Upstream string `json:"upstream"`
+	// The url of the target.
+	URL string `json:"url"`
+	// Whether the target is kept out of rotation by an operator.
+	Drained bool `json:"drained"`
+}
+
+// logLevelBody is the minimum level of the logged messages.
+type logLevelBody struct {
+	// The name of the level: debug, info or error.
+	Level string `json:"level"`
+}
+
+// RegisterManagement exposes the cache, upstream, log level and maintenance management under /v1/admin.
+// The requests are authenticated with the bearer tokens set with SetTokens and audit-logged.
+// The upstreams are the ones of the health checker and the registry registered before,
+// the maintenance can be toggled for the public routes with the specified names.
+func (a *API) RegisterManagement(appCache *cache.LocalCache, mode *maintenance.Mode, routes []string) {
+	a.appCache = appCache
+	a.maintenance = mode
+	a.routes = make(map[string]bool, len(routes))
+
+	for _, route := range routes {
+		a.routes[route] = true
+	}
+
+	management := a.router.PathPrefix("/v1/admin").Subrouter()
+	management.Use(a.auditMiddleware, a.authMiddleware)
+
+	management.HandleFunc("/cache", a.listCache).Methods(http.MethodGet).Name("cache.list")
+	management.HandleFunc("/cache", a.purgeCache).Methods(http.MethodDelete).Name("cache.purge")
+	management.HandleFunc("/cache/{page:[0-9]+}", a.getCachePage).Methods(http.MethodGet).Name("cache.inspect")
+	management.HandleFunc("/cache/{page:[0-9]+}", a.deleteCachePage).Methods(http.MethodDelete).Name("cache.delete")
+	management.HandleFunc("/upstreams", a.getUpstreams).Methods(http.MethodGet).Name("upstreams.list")
+	management.HandleFunc("/upstreams/connections", a.getUpstreamConnections).Methods(http.MethodGet).
+		Name("upstreams.connections")
+	management.HandleFunc("/upstreams/{name}/drain", a.drainTarget).Methods(http.MethodPost).Name("upstreams.drain")
+	management.HandleFunc("/upstreams/{name}/undrain", a.undrainTarget).Methods(http.MethodPost).
+		Name("upstreams.undrain")
+	management.HandleFunc("/log/level", a.getLogLevel).Methods(http.MethodGet).Name("log.get")
+	management.HandleFunc("/log/level", a.setLogLevel).Methods(http.MethodPut).Name("log.set")
+	management.HandleFunc("/maintenance", a.getMaintenance).Methods(http.MethodGet).Name("maintenance.get")
+	management.HandleFunc("/maintenance", a.setMaintenance).Methods(http.MethodPut).Name("maintenance.set")
+}
+
+// listCache handles the request for listing the cached pages.
+func (a *API) listCache(responseWriter http.ResponseWriter, req *http.Request) {
+	entries := a.appCache.Entries()
+	response := make([]cacheEntryResponse, 0, len(entries))
+
+	for _, entry := range entries {
+		response = append(response, cacheEntryResponse{
+			Page:     entry.Page,
+			Items:    len(entry.Items),
+			ExpireAt: entry.ExpireAt,
+		})
+	}
+
+	a.writeJSON(responseWriter, req, http.StatusOK, response)
+}
+
+// getCachePage handles the request for inspecting a cached page.
+func (a *API) getCachePage(responseWriter http.ResponseWriter, req *http.Request) {
+	page, _ := strconv.Atoi(mux.Vars(req)["page"])
+
+	entry, ok := a.appCache.Entry(page)
+	if !ok {
+		problem.Write(responseWriter, req, http.StatusNotFound, fmt.Sprintf("the page %d isn't cached", page))
+
+		return
+	}
+
+	a.writeJSON(responseWriter, req, http.StatusOK, cachePageResponse{
+		Page:     entry.Page,
+		ExpireAt: entry.ExpireAt,
+		Items:    entry.Items,
+	})
+}
+
+// deleteCachePage handles the request for purging a cached page.
+func (a *API) deleteCachePage(responseWriter http.ResponseWriter, req *http.Request) {
+	page, _ := strconv.Atoi(mux.Vars(req)["page"])
+
+	setAuditDetail(req, "page=%d", page)
+
+	if !a.appCache.Delete(page) {
+		problem.Write(responseWriter, req, http.StatusNotFound, fmt.Sprintf("the page %d isn't cached", page))
+
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusNoContent)
+}
+
+// purgeCache handles the request for purging all the cached pages.
+func (a *API) purgeCache(responseWriter http.ResponseWriter, req *http.Request) {
+	purged := a.appCache.Purge()
+
+	setAuditDetail(req, "purged=%d", purged)
+
+	a.writeJSON(responseWriter, req, http.StatusOK, purgeResponse{Purged: purged})
+}
+
+// drainTarget handles the request for taking a target out of rotation.
+func (a *API) drainTarget(responseWriter http.ResponseWriter, req *http.Request) {
+	a.setTargetDrained(responseWriter, req, true)
+}
+
+// undrainTarget handles the request for returning a drained target to rotation.
+func (a *API) undrainTarget(responseWriter http.ResponseWriter, req *http.Request) {
+	a.setTargetDrained(responseWriter, req, false)
+}
+
+// setTargetDrained drains or undrains the target of the upstream selected by the request.
+func (a *API) setTargetDrained(responseWriter http.ResponseWriter, req *http.Request, drained bool) {
+	name := mux.Vars(req)["name"]
+
+	var body targetRequest
+
+	if err := decodeBody(req, &body); err != nil || body.URL == "" {
+		problem.Write(responseWriter, req, http.StatusBadRequest, `the body must be a JSON object with the target "url"`)
+
+		return
+	}
+
+	setAuditDetail(req, "upstream=%s url=%s", name, body.URL)
+
+	target, ok := a.target(name, body.URL)
+	if !ok {
+		problem.Write(responseWriter, req, http.StatusNotFound,
+			fmt.Sprintf("the %s upstream has no target %s", name, body.URL))
+
+		return
+	}
+
+	if drained {
+		target.Drain()
+	} else {
+		target.Undrain()
+	}
+
+	a.writeJSON(responseWriter, req, http.StatusOK, targetResponse{
+		Upstream: name,
+		URL:      target.URL.String(),
+		Drained:  target.Drained(),
+	})
+}
+
+// target returns the target with the url of the upstream with the specified name.
+func (a *API) target(name, targetURL string) (*balancer.Target, bool) {
+	u, ok := a.upstreams.Get(name)
+	if !ok {
+		return nil, false
+	}
+
+	for _, target := range u.Balancer().Targets() {
+		if target.URL.String() == targetURL {
+			return target, true
+		}
+	}
+
+	return nil, false
+}
+
+// getLogLevel handles the request for getting the minimum level of the logged messages.
+func (a *API) getLogLevel(responseWriter http.ResponseWriter, req *http.Request) {
+	a.writeJSON(responseWriter, req, http.StatusOK, logLevelBody{Level: logger.CurrentLevel().String()})
+}
+
+// setLogLevel handles the request for changing the minimum level of the logged messages.
+// The level of the config file applies again on the next config reload.
+func (a *API) setLogLevel(responseWriter http.ResponseWriter, req *http.Request) {
+	var body logLevelBody
+
+	if err := decodeBody(req, &body); err != nil {
+		problem.Write(responseWriter, req, http.StatusBadRequest, `the body must be a JSON object with the "level"`)
+
+		return
+	}
+
+	setAuditDetail(req, "level=%s", body.Level)
+
+	level, err := logger.ParseLevel(body.Level)
+	if err != nil || body.Level == "" {
+		problem.Write(responseWriter, req, http.StatusBadRequest, "the level must be debug, info or error")
+
+		return
+	}
+
+	setAuditDetail(req, "from=%s to=%s", logger.CurrentLevel(), level)
+	logger.SetLevel(level)
+
+	a.writeJSON(responseWriter, req, http.StatusOK, logLevelBody{Level: level.String()})
+}
+
+// getMaintenance handles the request for getting the scope of the maintenance.
+func (a *API) getMaintenance(responseWriter http.ResponseWriter, req *http.Request) {
+	a.writeJSON(responseWriter, req, http.StatusOK, a.maintenance.Status())
+}
+
+// setMaintenance handles the request for turning the maintenance on or off.
+// It applies until the maintenance enabled flag or routes of the config file change.
+func (a *API) setMaintenance(responseWriter http.ResponseWriter, req *http.Request) {
+	var body maintenance.Status
+
+	if err := decodeBody(req, &body); err != nil {
+		problem.Write(responseWriter, req, http.StatusBadRequest,
+			`the body must be a JSON object with "enabled" and the optional "routes"`)
+
+		return
+	}
+
+	setAuditDetail(req, "enabled=%t routes=%v", body.Enabled, body.Routes)
+
+	for _, route := range body.Routes {
+		if !a.routes[route] {
+			problem.Write(responseWriter, req, http.StatusBadRequest, fmt.Sprintf("unknown route %q", route))
+
+			return
+		}
+	}
+
+	a.maintenance.Toggle(body.Enabled, body.Routes)
+
+	a.writeJSON(responseWriter, req, http.StatusOK, a.maintenance.Status())
+}
+
+// decodeBody decodes the JSON body of the request into v.
+func decodeBody(req *http.Request, v any) error {
+	data, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("reading the request body: %w", err)
+	}
+
+	if err := jsonoperations.Decode(data, v); err != nil {
+		return fmt.Errorf("decoding the request body: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"net/url"
+	"strings"
+)
+
+// redacted replaces the values of the secrets.
+const redacted = "[REDACTED]"
+
+// secretKeys are the suffixes of the keys holding secrets, compared in lower case.
+var secretKeys = []string{ //nolint:gochecknoglobals
+	"password", "secret", "token", "tokens", "apikey", "privatekey", "credentials",
+}
+
+// Redact returns a copy of the settings with the values of the secret keys replaced
+// and the passwords of the urls removed.
+func Redact(settings map[string]any) map[string]any {
+	redactedSettings := make(map[string]any, len(settings))
+
+	for key, value := range settings {
+		if isSecret(key) {
+			redactedSettings[key] = redacted
+
+			continue
+		}
+
+		redactedSettings[key] = redactValue(value)
+	}
+
+	return redactedSettings
+}
+
+// redactValue returns a copy of the value with the secrets of the nested settings redacted.
+func redactValue(value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		return Redact(typed)
+	case []any:
+		items := make([]any, 0, len(typed))
+		for _, item := range typed {
+			items = append(items, redactValue(item))
+		}
+
+		return items
+	case string:
+		return redactURL(typed)
+	default:
+		return value
+	}
+}
+
+// isSecret reports whether the key holds a secret.
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, suffix := range secretKeys {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactURL returns the value with the password removed if it's a url with one.
+func redactURL(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.User == nil {
+		return value
+	}
+
+	if _, ok := parsed.User.Password(); !ok {
+		return value
+	}
+
+	return parsed.Redacted()
+}
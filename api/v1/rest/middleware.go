@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/metrics"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+	"github.com/gorilla/mux"
+)
+
+// userIDLength is the number of hex digits of the user identifiers.
+const userIDLength = 16
+
+// contextMiddleware stores the request-scoped values in the request context
+// and applies the deadline configured for the matched route.
+// The request ID is stored by requestid.Middleware at the edge.
+func (r *API) contextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		if credentials := req.Header.Get("Authorization"); credentials != "" {
+			ctx = requestctx.WithUser(ctx, userID(credentials))
+		}
+
+		if route := mux.CurrentRoute(req); route != nil {
+			if timeout := r.routeTimeout(route.GetName()); timeout > 0 {
+				var cancel context.CancelFunc
+
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+
+				defer cancel()
+			}
+		}
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// userID returns the identifier of the user with the credentials, a hash of them,
+// so the credentials don't travel with the context into the logs and the rate limiter.
+func userID(credentials string) string {
+	sum := sha256.Sum256([]byte(credentials))
+
+	return hex.EncodeToString(sum[:])[:userIDLength]
+}
+
+// routeTimeout returns the deadline of the route with the specified name, zero if none.
+func (r *API) routeTimeout(name string) time.Duration {
+	r.timeoutsMu.RLock()
+	defer r.timeoutsMu.RUnlock()
+
+	return r.routeTimeouts[strings.ToLower(name)]
+}
+
+// maintenanceMiddleware answers the requests of the routes under maintenance with the maintenance response.
+func (r *API) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := mux.CurrentRoute(req)
+		if r.maintenance == nil || route == nil {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		if r.maintenance.Intercept(w, req, route.GetName()) {
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// rateLimitMiddleware rejects the requests of the clients exceeding the rate limit of the matched route.
+func (r *API) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := mux.CurrentRoute(req)
+		if r.rateLimiter == nil || route == nil {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		rule, ok := r.rateLimiter.Rule(route.GetName())
+		if !ok {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		result := r.rateLimiter.Allow(rule, r.rateLimiter.ClientKey(req, rule))
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", retryAfterSeconds(result.Reset))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", retryAfterSeconds(result.RetryAfter))
+			problem.Write(w, req, http.StatusTooManyRequests, "the rate limit is exceeded")
+
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// httpMetrics are the metrics of the handled requests.
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+// observe records a handled request.
+func (m *httpMetrics) observe(route, method string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+
+	m.requests.Inc(route, method, statusLabel)
+	m.duration.Observe(duration.Seconds(), route, method, statusLabel)
+}
@@ -1,7 +1,16 @@
 package rest
 
 import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
 	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
 )
 
 type MarketPageResponse struct {
@@ -42,3 +51,50 @@ func itemsToResponse(page int, items []marketdomain.MarketItem) *MarketPageRespo
 
 	return result
 }
+
+// retryAfterSeconds formats the duration as the value of the Retry-After header, rounding up to whole seconds.
+func retryAfterSeconds(retryAfter time.Duration) string {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return strconv.Itoa(seconds)
+}
+
+// errorProblem returns the response status and the problem detail matching the kind of the error.
+// The details don't expose the internal error messages.
+func errorProblem(err error) (int, string) {
+	switch {
+	case errors.Is(err, errdomain.ErrNotFound):
+		return http.StatusNotFound, "the requested resource doesn't exist"
+	case errors.Is(err, errdomain.ErrBadRequest):
+		return http.StatusBadRequest, "the request is invalid"
+	case errors.Is(err, errdomain.ErrUnauthorized):
+		return http.StatusUnauthorized, "the credentials were rejected"
+	case errors.Is(err, errdomain.ErrForbidden):
+		return http.StatusForbidden, "the request isn't allowed"
+	case errors.Is(err, errdomain.ErrRateLimited):
+		return http.StatusTooManyRequests, "the upstream service is limiting the rate of the requests"
+	case errors.Is(err, errdomain.ErrMalformedPayload):
+		return http.StatusBadGateway, "the upstream service responded with an unexpected payload"
+	case errors.Is(err, errdomain.ErrUnexpectedResponse):
+		return http.StatusBadGateway, "the upstream service responded with an unexpected status"
+	case errors.Is(err, errdomain.ErrUpstreamUnavailable):
+		return http.StatusServiceUnavailable, "the upstream service is unavailable"
+	case errors.Is(err, errdomain.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "the upstream service didn't respond in time"
+	default:
+		return http.StatusInternalServerError, "the request couldn't be handled"
+	}
+}
+
+// notFound handles the requests matching no route.
+func notFound(w http.ResponseWriter, req *http.Request) {
+	problem.Write(w, req, http.StatusNotFound, "no route matches the path")
+}
+
+// methodNotAllowed handles the requests matching a route with another method.
+func methodNotAllowed(w http.ResponseWriter, req *http.Request) {
+	problem.Write(w, req, http.StatusMethodNotAllowed, "the route doesn't allow the method")
+}
@@ -1,12 +1,27 @@
 package rest
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/UArt-project/UArt-proxy/domain/authdomain"
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
 	"github.com/UArt-project/UArt-proxy/internal/service"
+	"github.com/UArt-project/UArt-proxy/pkg/circuitbreaker"
+	"github.com/UArt-project/UArt-proxy/pkg/httpx"
 	"github.com/UArt-project/UArt-proxy/pkg/jsonoperations"
 	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/maintenance"
+	"github.com/UArt-project/UArt-proxy/pkg/metrics"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+	"github.com/UArt-project/UArt-proxy/pkg/proxy"
+	"github.com/UArt-project/UArt-proxy/pkg/ratelimit"
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
 	"github.com/gorilla/mux"
 )
 
@@ -18,6 +33,16 @@ type API struct {
 	loggr *logger.Logger
 	// Router.
 	router *mux.Router
+	// The rate limiter of the clients.
+	rateLimiter *ratelimit.Limiter
+	// The maintenance mode of the routes.
+	maintenance *maintenance.Mode
+	// The request metrics, nil if not instrumented.
+	httpMetrics *httpMetrics
+	// The deadlines of the routes by the lowercased route name.
+	routeTimeouts map[string]time.Duration
+	// Guards the route deadlines.
+	timeoutsMu *sync.RWMutex
 }
 
 // NewAPI creates a new instance of the API.
@@ -25,11 +50,18 @@ func NewAPI(appService service.AppService, loggr *logger.Logger) *API {
 	router := mux.NewRouter()
 
 	api := &API{
-		appService: appService,
-		loggr:      loggr,
-		router:     router,
+		appService:    appService,
+		loggr:         loggr,
+		router:        router,
+		routeTimeouts: make(map[string]time.Duration),
+		timeoutsMu:    new(sync.RWMutex),
 	}
 
+	router.Use(api.contextMiddleware, api.maintenanceMiddleware, api.rateLimitMiddleware)
+
+	router.NotFoundHandler = api.contextMiddleware(http.HandlerFunc(notFound))
+	router.MethodNotAllowedHandler = api.contextMiddleware(http.HandlerFunc(methodNotAllowed))
+
 	api.HandleFunc()
 
 	return api
@@ -37,61 +69,157 @@ func NewAPI(appService service.AppService, loggr *logger.Logger) *API {
 
 // HandleFunc registers handlers for REST API requests.
 func (r *API) HandleFunc() {
-	r.router.HandleFunc("/v1/market/{page}", r.getMarketPage).Methods(http.MethodGet)
-	r.router.HandleFunc("/v1/auth", r.getAuth).Methods(http.MethodGet)
-	r.router.HandleFunc("/login/oauth2/code/google", r.getAuthCallback).Methods(http.MethodGet)
+	r.router.HandleFunc("/v1/market/{page}", r.getMarketPage).Methods(http.MethodGet).Name("market")
+	r.router.HandleFunc("/v1/auth", r.getAuth).Methods(http.MethodGet).Name("auth")
+	r.router.HandleFunc("/login/oauth2/code/google", r.getAuthCallback).Methods(http.MethodGet).Name("authCallback")
+}
+
+// SetRouteTimeouts sets the deadlines of the routes by the route name,
+// the proxy routes are named after their prefix.
+// The names are matched case-insensitively, since the keys of the decoded config maps are lowercased.
+// It can be called while serving.
+func (r *API) SetRouteTimeouts(timeouts map[string]time.Duration) {
+	r.timeoutsMu.Lock()
+	defer r.timeoutsMu.Unlock()
+
+	for name, timeout := range timeouts {
+		r.routeTimeouts[strings.ToLower(name)] = timeout
+	}
+}
+
+// RegisterProxyRoutes registers generic reverse proxy handlers for the routes,
+// sending the requests with the transport of the upstream registry.
+// The routes are matched after the typed handlers registered in HandleFunc.
+func (r *API) RegisterProxyRoutes(routes []proxy.Route, registry *upstream.Registry) error {
+	for _, route := range routes {
+		transport, err := registry.Transport(route.TLS)
+		if err != nil {
+			return fmt.Errorf("creating the transport of route %s: %w", route.Prefix, err)
+		}
+
+		handler, err := proxy.NewHandler(route, transport, r.loggr)
+		if err != nil {
+			return fmt.Errorf("creating the proxy handler: %w", err)
+		}
+
+		muxRoute := r.router.PathPrefix(route.Prefix).Handler(handler).Name(route.Prefix)
+		if len(route.Methods) > 0 {
+			muxRoute.Methods(route.Methods...)
+		}
+
+		if route.Timeout > 0 {
+			r.SetRouteTimeouts(map[string]time.Duration{route.Prefix: route.Timeout})
+		}
+	}
+
+	return nil
+}
+
+// RouteNames returns the names of the registered routes, the proxy routes are named after their prefix.
+func (r *API) RouteNames() []string {
+	var names []string
+
+	_ = r.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if name := route.GetName(); name != "" {
+			names = append(names, name)
+		}
+
+		return nil
+	})
+
+	return names
+}
+
+// SetRateLimiter sets the rate limiter of the clients applied per route.
+func (r *API) SetRateLimiter(limiter *ratelimit.Limiter) {
+	r.rateLimiter = limiter
+}
+
+// SetMaintenance sets the maintenance mode applied per route.
+func (r *API) SetMaintenance(mode *maintenance.Mode) {
+	r.maintenance = mode
+}
+
+// Instrument records the metrics of the requests in the registry.
+func (r *API) Instrument(reg *metrics.Registry) {
+	r.httpMetrics = &httpMetrics{
+		requests: reg.NewCounterVec("uart_proxy_http_requests_total",
+			"Number of handled requests by route, method and status.", "route", "method", "status"),
+		duration: reg.NewHistogramVec("uart_proxy_http_request_duration_seconds",
+			"Duration of the handled requests by route, method and status.", metrics.DefaultBuckets,
+			"route", "method", "status"),
+	}
 }
 
 // ServeHTTP handles REST API requests.
 func (r *API) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.router.ServeHTTP(w, req)
+	if r.httpMetrics == nil {
+		r.router.ServeHTTP(w, req)
+
+		return
+	}
+
+	start := time.Now()
+	recorder := httpx.NewRecorder(w)
+
+	r.router.ServeHTTP(recorder, req)
+
+	r.httpMetrics.observe(r.routeName(req), req.Method, recorder.Status(), time.Since(start))
+}
+
+// routeName returns the name of the route matching the request.
+func (r *API) routeName(req *http.Request) string {
+	var match mux.RouteMatch
+
+	if r.router.Match(req, &match) && match.Route != nil && match.Route.GetName() != "" {
+		return match.Route.GetName()
+	}
+
+	return "unmatched"
 }
 
 // getMarketPage handles the request for getting a page of market items.
 func (r *API) getMarketPage(responseWriter http.ResponseWriter, req *http.Request) {
 	page, err := getPathNumber(req)
 	if err != nil {
-		r.loggr.Error("getting the page number from the path: %v", err)
-		responseWriter.WriteHeader(http.StatusBadRequest)
+		r.loggr.WithContext(req.Context()).Error("getting the page number from the path: %v", err)
+		problem.Write(responseWriter, req, http.StatusBadRequest, "the page number must be an integer")
 
 		return
 	}
 
-	items, err := r.appService.GetMarketPage(page)
-	if err != nil {
-		r.loggr.Error("getting the page of items: %v", err)
-		responseWriter.WriteHeader(http.StatusInternalServerError)
+	// The stats are carried already if the access log is on, the handler needs them for the cache status anyway.
+	ctx := req.Context()
 
-		return
+	stats, ok := requestctx.StatsFrom(ctx)
+	if !ok {
+		ctx, stats = requestctx.WithStats(ctx)
 	}
 
-	response := itemsToResponse(page, items)
+	items, err := r.appService.GetMarketPage(ctx, page)
 
-	encData, err := jsonoperations.Encode(response)
-	if err != nil {
-		r.loggr.Error("encoding the response body: %v", err)
-		responseWriter.WriteHeader(http.StatusInternalServerError)
-
-		return
+	if cacheStatus := stats.CacheStatus(); cacheStatus != "" {
+		responseWriter.Header().Set("X-Cache", strings.ToUpper(cacheStatus))
 	}
 
-	responseWriter.Header().Set("Content-Type", "application/json")
-	responseWriter.WriteHeader(http.StatusOK)
-
-	_, err = responseWriter.Write(encData)
 	if err != nil {
-		r.loggr.Error("writing the response body: %v", err)
+		r.loggr.WithContext(req.Context()).Error("getting the page of items: %v", err)
+		r.writeError(responseWriter, req, err)
 
 		return
 	}
+
+	response := itemsToResponse(page, items)
+
+	r.writeJSON(responseWriter, req, http.StatusOK, response)
 }
 
 // getAuth handles the request for getting the auth url.
 func (r *API) getAuth(responseWriter http.ResponseWriter, req *http.Request) {
-	url, err := r.appService.GetAuthPage()
+	url, err := r.appService.GetAuthPage(req.Context())
 	if err != nil {
-		r.loggr.Error("getting the auth page: %v", err)
-		responseWriter.WriteHeader(http.StatusInternalServerError)
+		r.loggr.WithContext(req.Context()).Error("getting the auth page: %v", err)
+		r.writeError(responseWriter, req, err)
 
 		return
 	}
@@ -125,10 +253,10 @@ func (r *API) getAuthCallback(w http.ResponseWriter, req *http.Request) {
 		Prompt:   req.URL.Query().Get("prompt"),
 	}
 
-	token, err := r.appService.GetAuthToken(callbackData)
+	token, err := r.appService.GetAuthToken(req.Context(), callbackData)
 	if err != nil {
-		r.loggr.Error("getting the auth token: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		r.loggr.WithContext(req.Context()).Error("getting the auth token: %v", err)
+		r.writeError(w, req, err)
 
 		return
 	}
@@ -145,3 +273,43 @@ func (r *API) getAuthCallback(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Location", token.RedirectURL)
 	w.WriteHeader(http.StatusSeeOther)
 }
+
+// writeError writes the problem matching the error of the application service.
+func (r *API) writeError(responseWriter http.ResponseWriter, req *http.Request, err error) {
+	var openErr *circuitbreaker.OpenError
+
+	if errors.As(err, &openErr) {
+		responseWriter.Header().Set("Retry-After", retryAfterSeconds(openErr.RetryAfter))
+		problem.Write(responseWriter, req, http.StatusServiceUnavailable,
+			fmt.Sprintf("the %s service is temporarily unavailable", openErr.Name))
+
+		return
+	}
+
+	status, detail := errorProblem(err)
+
+	if status == http.StatusTooManyRequests {
+		responseWriter.Header().Set("Retry-After", retryAfterSeconds(errdomain.RetryAfter(err)))
+	}
+
+	problem.Write(responseWriter, req, status, detail)
+}
+
+// writeJSON encodes the data and writes it to the response with the status.
+func (r *API) writeJSON(responseWriter http.ResponseWriter, req *http.Request, status int, data any) {
+	encData, err := jsonoperations.Encode(data)
+	if err != nil {
+		r.loggr.WithContext(req.Context()).Error("encoding the response body: %v", err)
+		problem.Write(responseWriter, req, http.StatusInternalServerError, "the response couldn't be encoded")
+
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(status)
+
+	_, err = responseWriter.Write(encData)
+	if err != nil {
+		r.loggr.WithContext(req.Context()).Error("writing the response body: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
+	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
+	"github.com/UArt-project/UArt-proxy/internal/service"
+	"github.com/UArt-project/UArt-proxy/pkg/cache"
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/proxy"
+	"github.com/UArt-project/UArt-proxy/pkg/ratelimit"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
+)
+
+// fakeMarket is a market client counting the requests for pages.
+type fakeMarket struct {
+	calls atomic.Int64
+	err   error
+}
+
+// GetPage returns a page with a single item.
+func (m *fakeMarket) GetPage(ctx context.Context, page int) ([]marketdomain.MarketItem, error) {
+	m.calls.Add(1)
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return []marketdomain.MarketItem{{ID: "1", Name: "Poster", Price: 10}}, nil
+}
+
+// newCachingAPI creates an API serving the market pages through a cache with the TTL.
+func newCachingAPI(t *testing.T, market *fakeMarket, ttl time.Duration) (*API, *service.Service) {
+	t.Helper()
+
+	localCache := cache.NewLocalCache(time.Hour)
+	t.Cleanup(localCache.Stop)
+
+	appService := service.NewService(market, nil, nil, localCache, ttl)
+
+	return NewAPI(appService, logger.NewLogger(io.Discard, "test")), appService
+}
+
+// getPage requests the market page and returns the response.
+func getPage(api *API) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/market/1", nil))
+
+	return recorder
+}
+
+func TestMarketPageCacheHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		wait      time.Duration
+		wantCache []string
+		wantCalls int64
+	}{
+		{name: "miss then hit", ttl: time.Hour, wantCache: []string{"MISS", "HIT", "HIT"}, wantCalls: 1},
+		{
+			name:      "expired page read through again",
+			ttl:       20 * time.Millisecond,
+			wait:      30 * time.Millisecond,
+			wantCache: []string{"MISS", "MISS", "MISS"},
+			wantCalls: 3,
+		},
+		{name: "caching disabled", ttl: 0, wantCache: []string{"", "", ""}, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			market := new(fakeMarket)
+			api, _ := newCachingAPI(t, market, tt.ttl)
+
+			for i, want := range tt.wantCache {
+				if i > 0 {
+					time.Sleep(tt.wait)
+				}
+
+				recorder := getPage(api)
+
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("request %d status = %d, want %d", i, recorder.Code, http.StatusOK)
+				}
+
+				if got := recorder.Header().Get("X-Cache"); got != want {
+					t.Errorf("request %d X-Cache = %q, want %q", i, got, want)
+				}
+			}
+
+			if got := market.calls.Load(); got != tt.wantCalls {
+				t.Errorf("market calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMarketPageCacheTTLChange(t *testing.T) {
+	market := new(fakeMarket)
+	api, appService := newCachingAPI(t, market, 0)
+
+	if got := getPage(api).Header().Get("X-Cache"); got != "" {
+		t.Fatalf("X-Cache without a TTL = %q, want none", got)
+	}
+
+	appService.SetCacheTTL(time.Hour)
+
+	for i, want := range []string{"MISS", "HIT"} {
+		if got := getPage(api).Header().Get("X-Cache"); got != want {
+			t.Errorf("request %d X-Cache = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestMarketPageCacheMissOnError(t *testing.T) {
+	market := &fakeMarket{err: errdomain.New(errdomain.ErrUpstreamUnavailable, errors.New("market down"))}
+	api, _ := newCachingAPI(t, market, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		recorder := getPage(api)
+
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Errorf("request %d status = %d, want %d", i, recorder.Code, http.StatusServiceUnavailable)
+		}
+
+		// The failure isn't cached, every request reads through.
+		if got := recorder.Header().Get("X-Cache"); got != "MISS" {
+			t.Errorf("request %d X-Cache = %q, want MISS", i, got)
+		}
+	}
+
+	if got := market.calls.Load(); got != 2 {
+		t.Errorf("market calls = %d, want 2", got)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	api, _ := newCachingAPI(t, new(fakeMarket), 0)
+
+	limiter := ratelimit.NewLimiter([]ratelimit.Rule{{Route: "market", Rate: 0.5, Burst: 1}}, time.Hour, nil)
+	t.Cleanup(limiter.Stop)
+	api.SetRateLimiter(limiter)
+
+	if recorder := getPage(api); recorder.Code != http.StatusOK ||
+		recorder.Header().Get("RateLimit-Remaining") != "0" || recorder.Header().Get("Retry-After") != "" {
+		t.Fatalf("first request status = %d, headers = %v, want allowed with no tokens left",
+			recorder.Code, recorder.Header())
+	}
+
+	recorder := getPage(api)
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+
+	// A token is refilled every two seconds.
+	if got := recorder.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+
+	if got := recorder.Header().Get("RateLimit-Limit"); got != "1" {
+		t.Errorf("RateLimit-Limit = %q, want 1", got)
+	}
+}
+
+func TestRouteTimeoutsFromTheConfig(t *testing.T) {
+	api, _ := newCachingAPI(t, new(fakeMarket), 0)
+
+	// The keys of the decoded config maps are lowercased.
+	api.SetRouteTimeouts(map[string]time.Duration{"market": time.Second, "authcallback": 15 * time.Second})
+
+	for name, want := range map[string]time.Duration{"market": time.Second, "authCallback": 15 * time.Second, "auth": 0} {
+		if got := api.routeTimeout(name); got != want {
+			t.Errorf("routeTimeout(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestRouteNames(t *testing.T) {
+	api, _ := newCachingAPI(t, new(fakeMarket), 0)
+
+	got := api.RouteNames()
+	if len(got) != 3 || got[0] != "market" || got[1] != "auth" || got[2] != "authCallback" {
+		t.Errorf("RouteNames() = %v, want the built-in routes", got)
+	}
+}
+
+func TestProxyRouteMatching(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "files "+r.URL.Path)
+	}))
+	t.Cleanup(files.Close)
+
+	api, _ := newCachingAPI(t, new(fakeMarket), 0)
+
+	routes := []proxy.Route{
+		{Prefix: "/static/admin", Upstream: files.URL, StripPrefix: "/static", Methods: []string{http.MethodGet}},
+		{Prefix: "/static", Upstream: files.URL, Methods: []string{http.MethodGet, http.MethodHead}},
+		{Prefix: "/upload", Upstream: files.URL},
+	}
+
+	if err := api.RegisterProxyRoutes(routes, upstream.NewRegistry(upstream.TransportConfig{})); err != nil {
+		t.Fatalf("RegisterProxyRoutes() error = %v", err)
+	}
+
+	tests := []struct {
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{method: http.MethodGet, target: "/static/app.js", wantStatus: http.StatusOK, wantBody: "files /static/app.js"},
+		{method: http.MethodGet, target: "/static/admin/x", wantStatus: http.StatusOK, wantBody: "files /admin/x"},
+		{method: http.MethodPost, target: "/static/app.js", wantStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, target: "/upload/a", wantStatus: http.StatusOK, wantBody: "files /upload/a"},
+		{method: http.MethodGet, target: "/other", wantStatus: http.StatusNotFound},
+		// The typed handlers are matched before the proxy routes.
+		{method: http.MethodGet, target: "/v1/market/1", wantStatus: http.StatusOK, wantBody: `"Poster"`},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+
+		if recorder.Code != tt.wantStatus {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.target, recorder.Code, tt.wantStatus)
+
+			continue
+		}
+
+		if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+			t.Errorf("%s %s body = %q, want it to contain %q", tt.method, tt.target, recorder.Body.String(), tt.wantBody)
+		}
+	}
+}
@@ -1,88 +1,612 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/UArt-project/UArt-proxy/api/admin"
 	"github.com/UArt-project/UArt-proxy/api/v1/rest"
 	"github.com/UArt-project/UArt-proxy/cmd/server"
 	"github.com/UArt-project/UArt-proxy/cmd/server/config"
+	"github.com/UArt-project/UArt-proxy/internal/appconfig"
 	"github.com/UArt-project/UArt-proxy/internal/service"
+	"github.com/UArt-project/UArt-proxy/pkg/accesslog"
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
 	"github.com/UArt-project/UArt-proxy/pkg/cache"
+	"github.com/UArt-project/UArt-proxy/pkg/circuitbreaker"
+	"github.com/UArt-project/UArt-proxy/pkg/clientip"
 	"github.com/UArt-project/UArt-proxy/pkg/clients/authclient"
 	"github.com/UArt-project/UArt-proxy/pkg/clients/marketclient"
 	"github.com/UArt-project/UArt-proxy/pkg/configreader"
 	"github.com/UArt-project/UArt-proxy/pkg/cors"
+	"github.com/UArt-project/UArt-proxy/pkg/healthcheck"
 	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/maintenance"
+	"github.com/UArt-project/UArt-proxy/pkg/metrics"
+	"github.com/UArt-project/UArt-proxy/pkg/probe"
+	"github.com/UArt-project/UArt-proxy/pkg/ratelimit"
+	"github.com/UArt-project/UArt-proxy/pkg/requestid"
+	"github.com/UArt-project/UArt-proxy/pkg/rotatefile"
+	"github.com/UArt-project/UArt-proxy/pkg/tlsconfig"
+	"github.com/UArt-project/UArt-proxy/pkg/tracing"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
 	"github.com/UArt-project/UArt-proxy/pkg/workerpool"
 )
 
-const configFile = "config.yaml"
+const (
+	defaultConfigFile = "config.yaml"
+	// checkConfigCommand validates the config and exits instead of serving, e.g. in CI.
+	checkConfigCommand = "check-config"
+)
+
+// Exit codes of the application.
+const (
+	exitOK = iota
+	exitDrainTimeout
+	exitForced
+	exitInvalidConfig
+	exitInvalidArgs
+)
+
+// version of the application, set at build time with -ldflags "-X main.version=...".
+var version = "dev" //nolint:gochecknoglobals
+
+var (
+	errCacheStopped    = errors.New("the cache cleanup isn't running")
+	errUnknownExporter = errors.New("unknown tracing exporter")
+	errUnexpectedArgs  = errors.New("unexpected arguments")
+)
 
 func main() {
 	mainLogger := logger.NewLogger(os.Stdout, "main")
 
+	configPath := flag.String("config", envOrDefault(configreader.EnvConfig, defaultConfigFile),
+		"path of the config file, also set with "+configreader.EnvConfig)
+	profile := flag.String("profile", os.Getenv(configreader.EnvProfile),
+		"profile merged over the config file from config.<profile>.yaml next to it, also set with "+
+			configreader.EnvProfile)
+
+	// The flag errors exit with exitInvalidArgs too, the FlagSet reports them with the usage.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+
+	checkOnly, err := parseArgs(flag.CommandLine, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitOK)
+	}
+
+	if err != nil {
+		if errors.Is(err, errUnexpectedArgs) {
+			fmt.Fprintln(flag.CommandLine.Output(), err)
+			flag.Usage()
+		}
+
+		os.Exit(exitInvalidArgs)
+	}
+
+	var appConfig *appconfig.Config
+
+	err = configreader.Load(configreader.Options{
+		Path:    *configPath,
+		Profile: *profile,
+		Schema:  configreader.SchemaOf(appconfig.Config{}),
+	})
+	if err == nil {
+		appConfig, err = appconfig.Load(configreader.Current())
+	}
+
+	if checkOnly {
+		os.Exit(reportConfig(os.Stdout, err))
+	}
+
+	if err != nil {
+		mainLogger.Error("refusing to start with an invalid config: %v", err)
+		os.Exit(exitInvalidConfig)
+	}
+
 	mainLogger.Info("Starting the application...")
 
-	err := configreader.SetConfigFile(configFile)
+	if ignored := configreader.Current().IgnoredEnv(); len(ignored) > 0 {
+		mainLogger.Info("ignoring the environment variables matching no config key: %s", strings.Join(ignored, ", "))
+	}
+
+	metricsRegistry := metrics.NewRegistry()
+	metricsRegistry.RegisterRuntime()
+
+	upstreams := upstream.NewRegistry(appConfig.Transport)
+	upstreams.Instrument(metricsRegistry)
+
+	marketUpstream, err := getUpstream(upstreams, "market", appConfig.Market)
 	if err != nil {
-		mainLogger.Fatal("setting the config file: %v", err)
+		mainLogger.Fatal("creating the market upstream: %v", err)
 	}
 
-	marketURL := configreader.GetString("market.url")
-	marketTimeout := configreader.GetDuration("market.timeout")
+	marketServiceClient := marketclient.NewMarketServiceClient(marketUpstream, appConfig.Market.Timeout)
+	marketClient := marketclient.NewBreakerClient(marketServiceClient,
+		circuitbreaker.New("market", appConfig.Market.Breaker))
 
-	marketClient := marketclient.NewMarketServiceClient(marketURL, marketTimeout)
+	authUpstream, err := getUpstream(upstreams, "auth", appConfig.Auth)
+	if err != nil {
+		mainLogger.Fatal("creating the auth upstream: %v", err)
+	}
 
-	authURL := configreader.GetString("auth.url")
-	authTimeout := configreader.GetDuration("auth.timeout")
+	healthChecker := healthcheck.NewChecker(logger.NewLogger(os.Stdout, "healthcheck"))
+	healthChecker.Watch(marketUpstream, appConfig.Market.HealthCheck)
+	healthChecker.Watch(authUpstream, appConfig.Auth.HealthCheck)
+	healthChecker.Start()
 
-	authClient := authclient.NewAuthServiceClient(authURL, authTimeout)
+	authServiceClient := authclient.NewAuthServiceClient(authUpstream, appConfig.Auth.Timeout)
+	authClient := authclient.NewBreakerClient(authServiceClient, circuitbreaker.New("auth", appConfig.Auth.Breaker))
 
-	pool := workerpool.NewPool(configreader.GetInt("worker_pool_size"))
-	appCache := cache.NewLocalCache(configreader.GetDuration("cache.cleanup"))
-	appService := service.NewService(marketClient, authClient, pool, appCache)
+	pool := workerpool.NewPool(appConfig.WorkerPoolSize)
+	pool.Start()
+
+	appCache := cache.NewLocalCache(appConfig.Cache.Cleanup)
+	appService := service.NewService(marketClient, authClient, pool, appCache, appConfig.Cache.TTL)
 	restLogger := logger.NewLogger(os.Stdout, "rest")
 	restAPI := rest.NewAPI(appService, restLogger)
+	restAPI.Instrument(metricsRegistry)
+	registerComponentMetrics(metricsRegistry, appCache, pool)
+
+	appProbe := getProbe(appConfig.Readiness.Timeout, healthChecker, appCache)
+
+	adminLogger := logger.NewLogger(os.Stdout, "admin")
+	adminAPI := admin.NewAPI(adminLogger, logger.NewLogger(os.Stdout, "audit"))
+	adminAPI.RegisterProbe(appProbe)
+	adminAPI.RegisterHealthChecker(healthChecker)
+	adminAPI.RegisterUpstreams(upstreams)
+	adminAPI.RegisterMetrics(metricsRegistry)
+	adminAPI.RegisterProfiler()
+	adminAPI.RegisterBuildInfo(version)
+	adminAPI.RegisterConfig(func() map[string]any {
+		return configreader.Current().AllSettings()
+	})
+
+	clientIPs, err := clientip.NewResolver(appConfig.Server.TrustedProxies)
+	if err != nil {
+		mainLogger.Fatal("creating the client IP resolver: %v", err)
+	}
+
+	maintenanceMode, err := maintenance.NewMode(appConfig.Maintenance, clientIPs)
+	if err != nil {
+		mainLogger.Fatal("creating the maintenance mode: %v", err)
+	}
+
+	restAPI.SetMaintenance(maintenanceMode)
+
+	rateLimiter := ratelimit.NewLimiter(appConfig.RateLimit.Rules, appConfig.RateLimit.IdleTimeout, clientIPs)
+	restAPI.SetRateLimiter(rateLimiter)
+
+	components := &reloadable{
+		upstreams:     []*upstream.Upstream{marketUpstream, authUpstream},
+		healthChecker: healthChecker,
+		marketClient:  marketServiceClient,
+		authClient:    authServiceClient,
+		restAPI:       restAPI,
+		adminAPI:      adminAPI,
+		maintenance:   maintenanceMode,
+		rateLimiter:   rateLimiter,
+		corsOrigins:   cors.NewOrigins(nil),
+		appCache:      appCache,
+		appService:    appService,
+		loggr:         mainLogger,
+	}
+
+	settings, err := components.read(configreader.Current())
+	if err != nil {
+		mainLogger.Fatal("reading the runtime settings: %v", err)
+	}
+
+	components.apply(settings)
+
+	if len(settings.adminTokens) == 0 {
+		mainLogger.Info("no admin token is set, the profiler, config and management endpoints reject all the requests")
+	}
+
+	err = restAPI.RegisterProxyRoutes(appConfig.Routes, upstreams)
+	if err != nil {
+		mainLogger.Fatal("registering the proxy routes: %v", err)
+	}
+
+	adminAPI.RegisterManagement(appCache, maintenanceMode, restAPI.RouteNames())
+
 	serverLogger := logger.NewLogger(os.Stdout, "server")
-	serverConfig := getServerConfig(cors.EnableCORS(restAPI), nil, serverLogger)
+	handler := cors.EnableCORS(restAPI, components.corsOrigins)
+
+	if appConfig.AccessLog.Enabled {
+		accessLogger, err := getAccessLogger(appConfig.AccessLog, clientIPs)
+		if err != nil {
+			mainLogger.Fatal("creating the access logger: %v", err)
+		}
+
+		handler = accessLogger.Middleware(handler)
+	}
+
+	tracer := tracing.NewTracer(tracing.NoopExporter{}, 0)
+
+	if appConfig.Tracing.Enabled {
+		tracer, err = getTracer(appConfig.Tracing)
+		if err != nil {
+			mainLogger.Fatal("creating the tracer: %v", err)
+		}
+
+		handler = tracer.Middleware(handler)
+	}
+
+	serverConfig := getServerConfig(appConfig.Server, requestid.Middleware(handler), nil, serverLogger)
+
+	// The admin server starts first and stops last, so the probes and the metrics cover the whole drain.
+	adminConfig := getServerConfig(appConfig.Server, requestid.Middleware(adminAPI), nil, adminLogger)
+	adminConfig.Address = appConfig.Admin.Address
+	adminConfig.WriteTimeout = appConfig.Admin.WriteTime
+
+	servers := []*server.Server{server.NewServer(adminConfig)}
+
+	var certReloader *tlsconfig.CertReloader
+
+	if tlsSettings := appConfig.Server.TLS; tlsSettings.Enabled {
+		serverConfig.TLSConfig, certReloader, err = getTLSConfig(tlsSettings)
+		if err != nil {
+			mainLogger.Fatal("configuring TLS: %v", err)
+		}
+
+		if tlsSettings.Redirect.Enabled {
+			redirectConfig := getServerConfig(appConfig.Server, tlsconfig.RedirectHandler(serverConfig.Address), nil,
+				serverLogger)
+			redirectConfig.Address = tlsSettings.Redirect.Address
+
+			servers = append(servers, server.NewServer(redirectConfig))
+		}
+	}
+
 	restServer := server.NewServer(serverConfig)
-	serverStopChan := make(chan struct{})
+	servers = append(servers, restServer)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	go func() {
+		for range hangups {
+			components.reload("SIGHUP")
+
+			if certReloader == nil {
+				continue
+			}
 
-	restServer.StartListening(serverStopChan)
+			if err := certReloader.Reload(); err != nil {
+				mainLogger.Error("reloading the certificate on SIGHUP: %v", err)
+
+				continue
+			}
+
+			mainLogger.Info("reloaded the certificate on SIGHUP")
+		}
+	}()
+
+	stopConfigWatch := func() {}
+
+	if interval := appConfig.Reload.Interval; interval > 0 {
+		stopConfigWatch = configreader.Watch(interval, func() {
+			components.reload("file change")
+		})
+	}
 
 	serverWG := new(sync.WaitGroup)
-	numberOfServersRunning := 1
+	numberOfServersRunning := len(servers)
 
 	serverWG.Add(numberOfServersRunning)
 
-	go func(wg *sync.WaitGroup) {
-		<-serverStopChan
+	for _, srv := range servers {
+		serverStopChan := make(chan struct{})
+
+		srv.StartListening(serverStopChan)
+
+		go func(wg *sync.WaitGroup) {
+			<-serverStopChan
+
+			wg.Done()
+		}(serverWG)
+	}
+
+	receivedSignal := <-signals
+
+	mainLogger.Info("received %v, shutting down...", receivedSignal)
+
+	go func() {
+		receivedSignal := <-signals
+
+		mainLogger.Error("received %v during the shutdown, exiting immediately", receivedSignal)
+		os.Exit(exitForced)
+	}()
+
+	// Fail the readiness probe first, so the load balancer stops routing new traffic before the listener closes.
+	appProbe.Drain()
+	time.Sleep(appConfig.Shutdown.Delay)
+
+	exitCode := exitOK
+	drainTimeout := appConfig.Shutdown.DrainTimeout
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), drainTimeout)
+
+	for i := len(servers) - 1; i >= 0; i-- {
+		err = servers[i].Shutdown(drainCtx)
+		if err != nil {
+			mainLogger.Error("draining the in-flight requests within %v: %v", drainTimeout, err)
 
-		wg.Done()
-	}(serverWG)
+			exitCode = exitDrainTimeout
+		}
+	}
 
+	cancelDrain()
 	serverWG.Wait()
+
+	stopConfigWatch()
+
+	if certReloader != nil {
+		certReloader.Stop()
+	}
+
+	healthChecker.Stop()
+	rateLimiter.Stop()
+	pool.Stop()
+	appCache.Stop()
+	upstreams.CloseIdleConnections()
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), drainTimeout)
+
+	err = tracer.Shutdown(flushCtx)
+	if err != nil {
+		mainLogger.Error("flushing the spans: %v", err)
+	}
+
+	cancelFlush()
+
+	mainLogger.Info("the application is stopped")
+	os.Exit(exitCode)
+}
+
+// registerComponentMetrics registers the metrics of the cache and the worker pool.
+func registerComponentMetrics(reg *metrics.Registry, appCache *cache.LocalCache, pool *workerpool.WorkerPool) {
+	cacheStats := appCache.Stats()
+
+	reg.NewCounterFunc("uart_proxy_cache_hits_total", "Number of market pages served from the cache.",
+		func() float64 { return float64(cacheStats.Hits.Load()) })
+	reg.NewCounterFunc("uart_proxy_cache_misses_total", "Number of market pages missing in the cache.",
+		func() float64 { return float64(cacheStats.Misses.Load()) })
+	reg.NewCounterFunc("uart_proxy_cache_evictions_total", "Number of expired market pages evicted from the cache.",
+		func() float64 { return float64(cacheStats.Evictions.Load()) })
+	reg.NewGaugeFunc("uart_proxy_cache_entries", "Number of market pages in the cache.",
+		func() float64 { return float64(appCache.Len()) })
+	reg.NewGaugeFunc("uart_proxy_workerpool_queue_depth", "Number of tasks waiting for a worker.",
+		func() float64 { return float64(pool.QueueDepth()) })
+	reg.NewGaugeFunc("uart_proxy_workerpool_busy_workers", "Number of workers running a task.",
+		func() float64 { return float64(pool.Busy()) })
+}
+
+// getProbe creates the readiness probe checking the upstreams, the last config reload and the cache.
+// The dependencies are checked with the timeout.
+func getProbe(timeout time.Duration, healthChecker *healthcheck.Checker, appCache *cache.LocalCache) *probe.Probe {
+	appProbe := probe.NewProbe(timeout)
+
+	for _, name := range []string{"market", "auth"} {
+		name := name
+
+		appProbe.AddDependency(name, func(ctx context.Context) error {
+			return healthChecker.Ping(ctx, name) //nolint:wrapcheck
+		})
+	}
+
+	// The instance serving an older config than the file isn't ready, until the file is fixed and reloaded.
+	appProbe.AddDependency("config", func(ctx context.Context) error {
+		if err := configreader.LastReloadError(); err != nil {
+			return fmt.Errorf("the last config reload was rejected: %w", err)
+		}
+
+		return nil
+	})
+
+	appProbe.AddDependency("cache", func(ctx context.Context) error {
+		if !appCache.Running() {
+			return errCacheStopped
+		}
+
+		return nil
+	})
+
+	return appProbe
+}
+
+// getBalancer creates the balancer of the upstream over its targets.
+// A single "url" key replaces the "targets" list when set, so a single target can be set from the environment.
+// The current targets with the same url and weight are reused, so they keep their health state.
+func getBalancer(upstreamConfig appconfig.UpstreamConfig, current []*balancer.Target) (balancer.Balancer, error) {
+	targetConfigs := upstreamConfig.Targets
+
+	if upstreamConfig.URL != "" || len(targetConfigs) == 0 {
+		targetConfigs = []appconfig.TargetConfig{{URL: upstreamConfig.URL}}
+	}
+
+	targets := make([]*balancer.Target, 0, len(targetConfigs))
+
+	for _, targetCfg := range targetConfigs {
+		target, err := balancer.NewTarget(targetCfg.URL, targetCfg.Weight)
+		if err != nil {
+			return nil, fmt.Errorf("creating the target: %w", err)
+		}
+
+		for _, currentTarget := range current {
+			if currentTarget.URL.String() == target.URL.String() && currentTarget.Weight == target.Weight {
+				target = currentTarget
+
+				break
+			}
+		}
+
+		targets = append(targets, target)
+	}
+
+	bal, err := balancer.New(upstreamConfig.Balancer, targets)
+	if err != nil {
+		return nil, fmt.Errorf("creating the balancer: %w", err)
+	}
+
+	return bal, nil
+}
+
+// reportConfig writes the result of the config validation and returns the exit code of the check-config mode.
+func reportConfig(output io.Writer, err error) int {
+	if err != nil {
+		fmt.Fprintf(output, "%v\n", err)
+
+		return exitInvalidConfig
+	}
+
+	fmt.Fprintln(output, "the config is valid")
+
+	return exitOK
+}
+
+// parseArgs parses the flags of the arguments around the optional check-config command
+// and reports whether it's given. Any other argument is rejected.
+func parseArgs(flags *flag.FlagSet, args []string) (bool, error) {
+	checkOnly := false
+
+	for {
+		if err := flags.Parse(args); err != nil {
+			return false, fmt.Errorf("parsing the flags: %w", err)
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			return checkOnly, nil
+		}
+
+		if args[0] != checkConfigCommand || checkOnly {
+			return false, fmt.Errorf("%w: %s", errUnexpectedArgs, strings.Join(args, " "))
+		}
+
+		checkOnly = true
+		args = args[1:]
+	}
+}
+
+// envOrDefault returns the value of the environment variable, the default value if it's empty.
+func envOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+// getUpstream creates the upstream with the specified name and registers it.
+func getUpstream(registry *upstream.Registry, name string, upstreamConfig appconfig.UpstreamConfig,
+) (*upstream.Upstream, error) {
+	bal, err := getBalancer(upstreamConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	newUpstream, err := registry.Register(name, bal, upstreamConfig.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("registering the upstream: %w", err)
+	}
+
+	newUpstream.SetRetryPolicy(upstreamConfig.Retry)
+
+	return newUpstream, nil
+}
+
+// getAccessLogger creates the access logger writing to stdout or to a rotating file,
+// logging the client IP addresses resolved with the resolver.
+func getAccessLogger(accessLogConfig appconfig.AccessLogConfig, resolver *clientip.Resolver,
+) (*accesslog.Logger, error) {
+	var output io.Writer = os.Stdout
+
+	if path := accessLogConfig.Output; path != "" && path != "stdout" {
+		file, err := rotatefile.Open(path, accessLogConfig.MaxSize, accessLogConfig.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("opening the access log file: %w", err)
+		}
+
+		output = file
+	}
+
+	accessLogger, err := accesslog.NewLogger(output, accessLogConfig.Format, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("creating the access logger: %w", err)
+	}
+
+	return accessLogger, nil
+}
+
+// getTracer creates the tracer exporting the spans to stdout or to an OTLP/HTTP collector.
+func getTracer(tracingConfig appconfig.TracingConfig) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+
+	switch name := tracingConfig.Exporter; name {
+	case "stdout":
+		exporter = tracing.NewStdoutExporter(os.Stdout)
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(tracing.OTLPConfig{
+			Endpoint:      tracingConfig.Endpoint,
+			ServiceName:   tracingConfig.ServiceName,
+			BatchSize:     tracingConfig.BatchSize,
+			FlushInterval: tracingConfig.FlushInterval,
+			Timeout:       tracingConfig.Timeout,
+		}, logger.NewLogger(os.Stdout, "tracing"))
+	case "", "none":
+		exporter = tracing.NoopExporter{}
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownExporter, name)
+	}
+
+	return tracing.NewTracer(exporter, tracingConfig.SampleRatio), nil
 }
 
-// getServerConfig reads the server configuration from the config file.
-func getServerConfig(handler http.Handler, errorLog *log.Logger, serverLogger *logger.Logger) *config.Config {
-	var (
-		address          = configreader.GetString("server.address")
-		readTime         = configreader.GetDuration("server.readTime")
-		writeTime        = configreader.GetDuration("server.writeTime")
-		idleTime         = configreader.GetDuration("server.idleTime")
-		readerHeaderTime = configreader.GetDuration("server.readerHeaderTime")
-	)
+// getTLSConfig creates the TLS configuration of the server with the certificate reloaded when the files change.
+func getTLSConfig(tlsSettings appconfig.ServerTLSConfig) (*tls.Config, *tlsconfig.CertReloader, error) {
+	certReloader, err := tlsconfig.NewCertReloader(tlsSettings.CertFile, tlsSettings.KeyFile,
+		logger.NewLogger(os.Stdout, "tls"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading the certificate: %w", err)
+	}
+
+	tlsConfig, err := tlsconfig.NewConfig(tlsSettings.Options, certReloader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating the TLS config: %w", err)
+	}
+
+	if interval := tlsSettings.ReloadInterval; interval > 0 {
+		certReloader.Watch(interval)
+	}
+
+	return tlsConfig, certReloader, nil
+}
 
+// getServerConfig creates the configuration of the server serving the handler.
+func getServerConfig(serverSettings appconfig.ServerConfig, handler http.Handler, errorLog *log.Logger,
+	serverLogger *logger.Logger,
+) *config.Config {
 	return &config.Config{
-		Address:           address,
-		ReadTimeout:       readTime,
-		WriteTimeout:      writeTime,
-		IdleTimeout:       idleTime,
-		ReadHeaderTimeout: readerHeaderTime,
+		Address:           serverSettings.Address,
+		ReadTimeout:       serverSettings.ReadTime,
+		WriteTimeout:      serverSettings.WriteTime,
+		IdleTimeout:       serverSettings.IdleTime,
+		ReadHeaderTimeout: serverSettings.ReaderHeaderTime,
 		ErrorLog:          errorLog,
 		ServerLogger:      serverLogger,
 		Handler:           handler,
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/api/admin"
+	"github.com/UArt-project/UArt-proxy/api/v1/rest"
+	"github.com/UArt-project/UArt-proxy/internal/appconfig"
+	"github.com/UArt-project/UArt-proxy/internal/service"
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
+	"github.com/UArt-project/UArt-proxy/pkg/cache"
+	"github.com/UArt-project/UArt-proxy/pkg/clients/authclient"
+	"github.com/UArt-project/UArt-proxy/pkg/clients/marketclient"
+	"github.com/UArt-project/UArt-proxy/pkg/configreader"
+	"github.com/UArt-project/UArt-proxy/pkg/cors"
+	"github.com/UArt-project/UArt-proxy/pkg/healthcheck"
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/maintenance"
+	"github.com/UArt-project/UArt-proxy/pkg/ratelimit"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
+)
+
+// reloadable are the components reconfigured when the config file changes.
+type reloadable struct {
+	// The upstreams getting new targets.
+	upstreams []*upstream.Upstream
+	// The health checker dropping the state of the removed targets.
+	healthChecker *healthcheck.Checker
+	// The clients getting new timeouts.
+	marketClient *marketclient.MarketServiceClient
+	authClient   *authclient.AuthServiceClient
+	// The API getting new route deadlines.
+	restAPI *rest.API
+	// The admin API getting new tokens.
+	adminAPI *admin.API
+	// The maintenance mode of the routes.
+	maintenance *maintenance.Mode
+	// The rate limiter getting new rules.
+	rateLimiter *ratelimit.Limiter
+	// The allowed CORS origins.
+	corsOrigins *cors.Origins
+	// The cache getting a new cleanup interval.
+	appCache *cache.LocalCache
+	// The service getting a new cache TTL.
+	appService *service.Service
+	// The logger reporting the reloads.
+	loggr *logger.Logger
+}
+
+// runtimeSettings are the settings applied without a restart.
+type runtimeSettings struct {
+	logLevel       logger.Level
+	balancers      map[string]balancer.Balancer
+	marketTimeout  time.Duration
+	authTimeout    time.Duration
+	routeTimeouts  map[string]time.Duration
+	rateLimitRules []ratelimit.Rule
+	corsOrigins    []string
+	cacheCleanup   time.Duration
+	cacheTTL       time.Duration
+	adminTokens    map[string]string
+	maintenance    *maintenance.Settings
+}
+
+// reload reads the config file again and applies it if it's valid, otherwise the current config is kept.
+func (r *reloadable) reload(trigger string) {
+	var settings runtimeSettings
+
+	err := configreader.Reload(func(candidate *configreader.Config) error {
+		var err error
+
+		settings, err = r.read(candidate)
+
+		return err
+	})
+	if err != nil {
+		r.loggr.Error("rejected the config reload on %s, keeping the current config: %v", trigger, err)
+
+		return
+	}
+
+	r.apply(settings)
+
+	r.loggr.Info("reloaded the config on %s", trigger)
+}
+
+// read validates the config and reads its runtime settings.
+func (r *reloadable) read(cfg *configreader.Config) (runtimeSettings, error) {
+	appConfig, err := appconfig.Load(cfg)
+	if err != nil {
+		return runtimeSettings{}, err //nolint:wrapcheck
+	}
+
+	settings := runtimeSettings{
+		balancers:      make(map[string]balancer.Balancer, len(r.upstreams)),
+		marketTimeout:  appConfig.Market.Timeout,
+		authTimeout:    appConfig.Auth.Timeout,
+		routeTimeouts:  appConfig.RouteTimeouts,
+		rateLimitRules: appConfig.RateLimit.Rules,
+		corsOrigins:    appConfig.CORS.AllowedOrigins,
+		cacheCleanup:   appConfig.Cache.Cleanup,
+		cacheTTL:       appConfig.Cache.TTL,
+		adminTokens:    appConfig.Admin.Tokens,
+	}
+
+	settings.logLevel, err = logger.ParseLevel(appConfig.Log.Level)
+	if err != nil {
+		return settings, fmt.Errorf("reading the log level: %w", err)
+	}
+
+	settings.maintenance, err = maintenance.Load(appConfig.Maintenance)
+	if err != nil {
+		return settings, fmt.Errorf("reading the maintenance config: %w", err)
+	}
+
+	upstreamConfigs := map[string]appconfig.UpstreamConfig{
+		"market": appConfig.Market,
+		"auth":   appConfig.Auth,
+	}
+
+	for _, u := range r.upstreams {
+		settings.balancers[u.Name()], err = getBalancer(upstreamConfigs[u.Name()], u.Balancer().Targets())
+		if err != nil {
+			return settings, fmt.Errorf("reading the %s upstream: %w", u.Name(), err)
+		}
+	}
+
+	return settings, nil
+}
+
+// apply reconfigures the components with the settings.
+func (r *reloadable) apply(settings runtimeSettings) {
+	logger.SetLevel(settings.logLevel)
+
+	for _, u := range r.upstreams {
+		u.SetBalancer(settings.balancers[u.Name()])
+	}
+
+	r.healthChecker.Prune()
+
+	r.marketClient.SetTimeout(settings.marketTimeout)
+	r.authClient.SetTimeout(settings.authTimeout)
+	r.restAPI.SetRouteTimeouts(settings.routeTimeouts)
+	r.rateLimiter.SetRules(settings.rateLimitRules)
+	r.corsOrigins.Set(settings.corsOrigins)
+	r.appCache.SetCleanupInterval(settings.cacheCleanup)
+	r.appService.SetCacheTTL(settings.cacheTTL)
+	r.adminAPI.SetTokens(settings.adminTokens)
+	r.maintenance.Apply(settings.maintenance)
+}
@@ -2,6 +2,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"log"
 	"net/http"
 	"time"
@@ -19,4 +20,6 @@ type Config struct {
 	ErrorLog          *log.Logger
 	ServerLogger      *logger.Logger
 	Handler           http.Handler
+	// TLSConfig enables HTTPS when set, the certificates come from its GetCertificate.
+	TLSConfig *tls.Config
 }
@@ -5,6 +5,7 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/UArt-project/UArt-proxy/cmd/server/config"
@@ -23,7 +24,7 @@ func NewServer(serverConfig *config.Config) *Server {
 		httpServer: &http.Server{
 			Addr:              serverConfig.Address,
 			Handler:           serverConfig.Handler,
-			TLSConfig:         nil,
+			TLSConfig:         serverConfig.TLSConfig,
 			ReadTimeout:       serverConfig.ReadTimeout,
 			ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
 			WriteTimeout:      serverConfig.WriteTimeout,
@@ -42,19 +43,36 @@ func NewServer(serverConfig *config.Config) *Server {
 // StartListening runs server.Server.
 func (s *Server) StartListening(stopChan chan struct{}) {
 	go func() {
-		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+
+		if s.httpServer.TLSConfig != nil {
+			err = s.httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = s.httpServer.ListenAndServe()
+		}
+
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			s.logger.Fatal("calling ListenAndServe resulted in %v", err)
 		}
 
 		close(stopChan)
 	}()
 
-	s.logger.Info("listening on address %s", s.httpServer.Addr)
+	if s.httpServer.TLSConfig != nil {
+		s.logger.Info("listening on address %s with TLS", s.httpServer.Addr)
+	} else {
+		s.logger.Info("listening on address %s", s.httpServer.Addr)
+	}
 }
 
-// Shutdown gracefully stops server.Server.
-func (s *Server) Shutdown() {
-	if err := s.httpServer.Shutdown(context.TODO()); err != nil {
-		s.logger.Error("server shutdown resulted in %v", err)
+// Shutdown gracefully stops server.Server, waiting for the in-flight requests until the context is done.
+// The connections still open after that are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		_ = s.httpServer.Close()
+
+		return fmt.Errorf("shutting the server down: %w", err)
 	}
+
+	return nil
 }
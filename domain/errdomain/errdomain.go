@@ -0,0 +1,97 @@
+// Package errdomain provides the kinds of errors shared by the clients, the service and the API.
+package errdomain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound means the requested resource doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrBadRequest means the request is invalid.
+	ErrBadRequest = errors.New("bad request")
+	// ErrUnauthorized means the upstream rejected the credentials of the request.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden means the upstream denied the request.
+	ErrForbidden = errors.New("forbidden")
+	// ErrRateLimited means the upstream limits the rate of the requests.
+	ErrRateLimited = errors.New("upstream rate limited")
+	// ErrUnexpectedResponse means the upstream responded with a status the proxy doesn't expect.
+	ErrUnexpectedResponse = errors.New("unexpected upstream response")
+	// ErrUpstreamUnavailable means the upstream can't be reached or failed to handle the request.
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	// ErrTimeout means the upstream didn't respond in time.
+	ErrTimeout = errors.New("upstream timeout")
+	// ErrMalformedPayload means the upstream responded with an unexpected payload.
+	ErrMalformedPayload = errors.New("malformed upstream payload")
+)
+
+// Error is an error of a kind carrying its cause.
+type Error struct {
+	// The kind of the error, one of the package errors.
+	Kind error
+	// The cause of the error.
+	Err error
+	// The delay the upstream asked for before retrying, zero if none.
+	RetryAfter time.Duration
+}
+
+// New returns an error of the kind caused by err.
+func New(kind, err error) error {
+	return &Error{
+		Kind: kind,
+		Err:  err,
+	}
+}
+
+// NewRetryAfter returns an error of the kind caused by err, retryable after the delay.
+func NewRetryAfter(kind, err error, retryAfter time.Duration) error {
+	return &Error{
+		Kind:       kind,
+		Err:        err,
+		RetryAfter: retryAfter,
+	}
+}
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause of the error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is the kind of the error.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind //nolint:errorlint,goerr113
+}
+
+// IsClientError reports whether the error is caused by the request rather than by the upstream.
+func IsClientError(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrBadRequest) ||
+		errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden)
+}
+
+// IsCanceled reports whether the request failed because the caller cancelled it rather than because of the upstream.
+func IsCanceled(ctx context.Context, err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled)
+}
+
+// RetryAfter returns the delay the upstream asked for before retrying, zero if none.
+func RetryAfter(err error) time.Duration {
+	var domainErr *Error
+
+	for errors.As(err, &domainErr) {
+		if domainErr.RetryAfter > 0 {
+			return domainErr.RetryAfter
+		}
+
+		err = domainErr.Err
+	}
+
+	return 0
+}
@@ -0,0 +1,614 @@
+// Package appconfig contains the typed configuration of the application and its validation.
+package appconfig
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/accesslog"
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
+	"github.com/UArt-project/UArt-proxy/pkg/circuitbreaker"
+	"github.com/UArt-project/UArt-proxy/pkg/clientip"
+	"github.com/UArt-project/UArt-proxy/pkg/configreader"
+	"github.com/UArt-project/UArt-proxy/pkg/healthcheck"
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/maintenance"
+	"github.com/UArt-project/UArt-proxy/pkg/proxy"
+	"github.com/UArt-project/UArt-proxy/pkg/ratelimit"
+	"github.com/UArt-project/UArt-proxy/pkg/retry"
+	"github.com/UArt-project/UArt-proxy/pkg/tlsconfig"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
+)
+
+const (
+	// maxWorkerPoolSize is the largest accepted worker pool size.
+	maxWorkerPoolSize = 1024
+	// minAdminTokenLength is the shortest accepted admin and maintenance bypass token.
+	minAdminTokenLength = 16
+)
+
+// Config is the configuration of the application.
+type Config struct {
+	// Reload configures the hot reload of the config file.
+	Reload ReloadConfig `mapstructure:"reload"`
+	// Log configures the application logs.
+	Log LogConfig `mapstructure:"log"`
+	// CORS configures the cross-origin requests.
+	CORS CORSConfig `mapstructure:"cors"`
+	// WorkerPoolSize is the number of the workers of the pool.
+	WorkerPoolSize int `mapstructure:"worker_pool_size"`
+	// Transport configures the transport shared by the upstreams.
+	Transport upstream.TransportConfig `mapstructure:"transport"`
+	// Market is the marketplace upstream.
+	Market UpstreamConfig `mapstructure:"market"`
+	// Auth is the auth upstream.
+	Auth UpstreamConfig `mapstructure:"auth"`
+	// RouteTimeouts are the deadlines of the routes by the route name.
+	RouteTimeouts map[string]time.Duration `mapstructure:"routeTimeouts"`
+	// RateLimit configures the rate limiting of the clients.
+	RateLimit RateLimitConfig `mapstructure:"rateLimit"`
+	// Routes are the proxied routes.
+	Routes []proxy.Route `mapstructure:"routes"`
+	// Cache configures the market cache.
+	Cache CacheConfig `mapstructure:"cache"`
+	// Readiness configures the readiness probe.
+	Readiness ReadinessConfig `mapstructure:"readiness"`
+	// AccessLog configures the access log.
+	AccessLog AccessLogConfig `mapstructure:"accessLog"`
+	// Tracing configures the distributed tracing.
+	Tracing TracingConfig `mapstructure:"tracing"`
+	// Shutdown configures the graceful shutdown.
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
+	// Server configures the API server.
+	Server ServerConfig `mapstructure:"server"`
+	// Admin configures the listener of the operational endpoints.
+	Admin AdminConfig `mapstructure:"admin"`
+	// Maintenance configures the maintenance mode of the routes.
+	Maintenance maintenance.Config `mapstructure:"maintenance"`
+}
+
+// ReloadConfig configures the hot reload of the config file.
+type ReloadConfig struct {
+	// Interval of checking the file for changes, disabled if zero.
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// LogConfig configures the application logs.
+type LogConfig struct {
+	// Level is the minimum level of the logged messages.
+	Level string `mapstructure:"level"`
+}
+
+// CORSConfig configures the cross-origin requests.
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the API.
+	AllowedOrigins []string `mapstructure:"allowedOrigins"`
+}
+
+// TargetConfig describes a single upstream target.
+type TargetConfig struct {
+	// URL of the target.
+	URL string `mapstructure:"url"`
+	// Weight of the target for the weighted balancer.
+	Weight int `mapstructure:"weight"`
+}
+
+// UpstreamConfig configures an upstream.
+type UpstreamConfig struct {
+	// URL of the single target, it replaces the targets when set.
+	URL string `mapstructure:"url"`
+	// Targets of the upstream.
+	Targets []TargetConfig `mapstructure:"targets"`
+	// Balancer is the balancing strategy.
+	Balancer string `mapstructure:"balancer"`
+	// Timeout of the calls to the upstream.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// TLS configures the connections to the upstream.
+	TLS upstream.TLSConfig `mapstructure:"tls"`
+	// HealthCheck configures the health checking of the targets.
+	HealthCheck healthcheck.Config `mapstructure:"healthCheck"`
+	// Breaker configures the circuit breaker.
+	Breaker circuitbreaker.Config `mapstructure:"breaker"`
+	// Retry is the retry policy of idempotent calls.
+	Retry retry.Policy `mapstructure:"retry"`
+}
+
+// RateLimitConfig configures the rate limiting of the clients.
+type RateLimitConfig struct {
+	// IdleTimeout after which the bucket of a client is evicted.
+	IdleTimeout time.Duration `mapstructure:"idleTimeout"`
+	// Rules are the rate limits of the routes.
+	Rules []ratelimit.Rule `mapstructure:"rules"`
+}
+
+// CacheConfig configures the market cache.
+type CacheConfig struct {
+	// Cleanup is the interval of evicting the expired pages.
+	Cleanup time.Duration `mapstructure:"cleanup"`
+	// TTL is the time the market pages are cached for, caching is disabled if zero.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// ReadinessConfig configures the readiness probe.
+type ReadinessConfig struct {
+	// Timeout of checking the dependencies.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// AccessLogConfig configures the access log.
+type AccessLogConfig struct {
+	// Enabled turns the access log on.
+	Enabled bool `mapstructure:"enabled"`
+	// Format of the entries.
+	Format string `mapstructure:"format"`
+	// Output is stdout or the path of the log file.
+	Output string `mapstructure:"output"`
+	// MaxSize of the log file in megabytes before it's rotated.
+	MaxSize int `mapstructure:"maxSize"`
+	// MaxBackups is the number of the rotated files kept.
+	MaxBackups int `mapstructure:"maxBackups"`
+}
+
+// TracingConfig configures the distributed tracing.
+type TracingConfig struct {
+	// Enabled turns the tracing on.
+	Enabled bool `mapstructure:"enabled"`
+	// Exporter is stdout, otlp or none.
+	Exporter string `mapstructure:"exporter"`
+	// Endpoint is the OTLP/HTTP traces url of the collector.
+	Endpoint string `mapstructure:"endpoint"`
+	// ServiceName is the service.name resource attribute.
+	ServiceName string `mapstructure:"serviceName"`
+	// SampleRatio of the new traces.
+	SampleRatio float64 `mapstructure:"sampleRatio"`
+	// BatchSize is the maximum number of spans sent at once.
+	BatchSize int `mapstructure:"batchSize"`
+	// FlushInterval is the maximum time a span waits in the queue.
+	FlushInterval time.Duration `mapstructure:"flushInterval"`
+	// Timeout of a single export request.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ShutdownConfig configures the graceful shutdown.
+type ShutdownConfig struct {
+	// Delay between failing the readiness probe and closing the listener.
+	Delay time.Duration `mapstructure:"delay"`
+	// DrainTimeout is the time the in-flight requests get to complete.
+	DrainTimeout time.Duration `mapstructure:"drainTimeout"`
+}
+
+// ServerConfig configures the API server.
+type ServerConfig struct {
+	// Address the server listens on.
+	Address string `mapstructure:"address"`
+	// ReadTime is the timeout of reading a request.
+	ReadTime time.Duration `mapstructure:"readTime"`
+	// WriteTime is the timeout of writing a response.
+	WriteTime time.Duration `mapstructure:"writeTime"`
+	// IdleTime is the time an idle keep-alive connection is kept open.
+	IdleTime time.Duration `mapstructure:"idleTime"`
+	// ReaderHeaderTime is the timeout of reading the request headers.
+	ReaderHeaderTime time.Duration `mapstructure:"readerHeaderTime"`
+	// TrustedProxies are the IP addresses and CIDRs of the proxies whose X-Forwarded-For entries are trusted.
+	TrustedProxies []string `mapstructure:"trustedProxies"`
+	// TLS configures the HTTPS termination.
+	TLS ServerTLSConfig `mapstructure:"tls"`
+}
+
+// ServerTLSConfig configures the HTTPS termination.
+type ServerTLSConfig struct {
+	tlsconfig.Options `mapstructure:",squash"`
+	// Enabled turns HTTPS on.
+	Enabled bool `mapstructure:"enabled"`
+	// CertFile and KeyFile are the PEM encoded certificate chain and private key.
+	CertFile string `mapstructure:"certFile"`
+	KeyFile  string `mapstructure:"keyFile"`
+	// ReloadInterval of checking the files for changes, disabled if zero.
+	ReloadInterval time.Duration `mapstructure:"reloadInterval"`
+	// Redirect configures the HTTP to HTTPS redirect listener.
+	Redirect RedirectConfig `mapstructure:"redirect"`
+}
+
+// RedirectConfig configures the HTTP to HTTPS redirect listener.
+type RedirectConfig struct {
+	// Enabled turns the listener on.
+	Enabled bool `mapstructure:"enabled"`
+	// Address the listener listens on.
+	Address string `mapstructure:"address"`
+}
+
+// AdminConfig configures the listener of the operational endpoints.
+type AdminConfig struct {
+	// Address the listener listens on.
+	Address string `mapstructure:"address"`
+	// WriteTime is the timeout of writing a response, it bounds the duration of the profiles.
+	WriteTime time.Duration `mapstructure:"writeTime"`
+	// Tokens are the bearer tokens of the management endpoints by the name of their holder.
+	Tokens map[string]string `mapstructure:"tokens"`
+}
+
+// ValidationError lists all the problems found in the config.
+type ValidationError struct {
+	// Problems found, each naming the key it concerns.
+	Problems []string
+}
+
+// Error returns all the problems, one per line.
+func (e *ValidationError) Error() string {
+	return strconv.Itoa(len(e.Problems)) + " problem(s) in the config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load decodes and validates the config, reporting all the problems in a *ValidationError.
+func Load(cfg *configreader.Config) (*Config, error) {
+	appConfig := new(Config)
+	v := new(validator)
+
+	err := cfg.UnmarshalExact(appConfig)
+	if err != nil {
+		var decodeErr interface{ WrappedErrors() []error }
+
+		if !errors.As(err, &decodeErr) {
+			return nil, fmt.Errorf("decoding the config: %w", err)
+		}
+
+		for _, wrapped := range decodeErr.WrappedErrors() {
+			v.problems = append(v.problems, decodeProblem(wrapped.Error()))
+		}
+	}
+
+	appConfig.validate(v)
+
+	if len(v.problems) > 0 {
+		return appConfig, &ValidationError{Problems: v.problems}
+	}
+
+	return appConfig, nil
+}
+
+// validate records the problems of the config.
+func (c *Config) validate(v *validator) {
+	v.check(c.Reload.Interval >= 0, "reload.interval", "must not be negative")
+
+	if _, err := logger.ParseLevel(c.Log.Level); err != nil {
+		v.add("log.level", err.Error())
+	}
+
+	v.check(c.WorkerPoolSize >= 1 && c.WorkerPoolSize <= maxWorkerPoolSize, "worker_pool_size",
+		fmt.Sprintf("must be between 1 and %d, got %d", maxWorkerPoolSize, c.WorkerPoolSize))
+
+	c.validateTransport(v)
+	c.Market.validate(v, "market")
+	c.Auth.validate(v, "auth")
+
+	for name, timeout := range c.RouteTimeouts {
+		v.check(timeout >= 0, "routeTimeouts."+name, "must not be negative")
+	}
+
+	c.validateRateLimit(v)
+	c.validateRoutes(v)
+
+	v.check(c.Cache.Cleanup > 0, "cache.cleanup", "must be positive")
+	v.check(c.Cache.TTL >= 0, "cache.ttl", "must not be negative")
+	v.check(c.Readiness.Timeout >= 0, "readiness.timeout", "must not be negative")
+
+	c.validateAccessLog(v)
+	c.validateTracing(v)
+
+	v.check(c.Shutdown.Delay >= 0, "shutdown.delay", "must not be negative")
+	v.check(c.Shutdown.DrainTimeout > 0, "shutdown.drainTimeout", "must be positive")
+
+	c.validateServer(v)
+	c.validateAdmin(v)
+	c.validateMaintenance(v)
+}
+
+// validateTransport records the problems of the transport.
+func (c *Config) validateTransport(v *validator) {
+	transport := c.Transport
+
+	v.check(transport.MaxIdleConns >= 0, "transport.maxIdleConns", "must not be negative")
+	v.check(transport.MaxIdleConnsPerHost >= 0, "transport.maxIdleConnsPerHost", "must not be negative")
+	v.check(transport.MaxConnsPerHost >= 0, "transport.maxConnsPerHost", "must not be negative")
+	v.check(transport.IdleConnTimeout >= 0, "transport.idleConnTimeout", "must not be negative")
+	v.check(transport.KeepAlive >= 0, "transport.keepAlive", "must not be negative")
+	v.check(transport.DialTimeout > 0, "transport.dialTimeout", "must be positive")
+	v.check(transport.TLSHandshakeTimeout >= 0, "transport.tlsHandshakeTimeout", "must not be negative")
+	v.check(transport.ResponseHeaderTimeout >= 0, "transport.responseHeaderTimeout", "must not be negative")
+	v.check(transport.ExpectContinueTimeout >= 0, "transport.expectContinueTimeout", "must not be negative")
+}
+
+// validate records the problems of the upstream with the specified key.
+func (u UpstreamConfig) validate(v *validator, key string) {
+	switch {
+	case u.URL != "":
+		v.checkURL(key+".url", u.URL)
+	case len(u.Targets) == 0:
+		v.add(key, "either url or targets is required")
+	}
+
+	for i, target := range u.Targets {
+		targetKey := fmt.Sprintf("%s.targets[%d]", key, i)
+
+		v.checkURL(targetKey+".url", target.URL)
+		v.check(target.Weight >= 0, targetKey+".weight", "must not be negative")
+	}
+
+	if _, err := balancer.New(u.Balancer, nil); err != nil {
+		v.add(key+".balancer", err.Error())
+	}
+
+	v.check(u.Timeout > 0, key+".timeout", "must be positive")
+
+	if err := u.TLS.Validate(); err != nil {
+		v.add(key+".tls", err.Error())
+	}
+
+	healthCheck := u.HealthCheck
+	v.check(healthCheck.Path == "" || strings.HasPrefix(healthCheck.Path, "/"), key+".healthCheck.path",
+		"must start with /")
+	v.check(healthCheck.Interval >= 0, key+".healthCheck.interval", "must not be negative")
+	v.check(healthCheck.Timeout >= 0, key+".healthCheck.timeout", "must not be negative")
+	v.check(healthCheck.UnhealthyThreshold >= 0, key+".healthCheck.unhealthyThreshold", "must not be negative")
+	v.check(healthCheck.HealthyThreshold >= 0, key+".healthCheck.healthyThreshold", "must not be negative")
+	v.check(healthCheck.ConsecutiveFailures >= 0, key+".healthCheck.consecutiveFailures", "must not be negative")
+	v.check(healthCheck.EjectionTime >= 0, key+".healthCheck.ejectionTime", "must not be negative")
+
+	breaker := u.Breaker
+	v.check(breaker.FailureRatio >= 0 && breaker.FailureRatio <= 1, key+".breaker.failureRatio",
+		"must be between 0 and 1")
+	v.check(breaker.Window >= 0, key+".breaker.window", "must not be negative")
+	v.check(breaker.MinRequests >= 0, key+".breaker.minRequests", "must not be negative")
+	v.check(breaker.Cooldown >= 0, key+".breaker.cooldown", "must not be negative")
+	v.check(breaker.HalfOpenRequests >= 0, key+".breaker.halfOpenRequests", "must not be negative")
+
+	policy := u.Retry
+	v.check(policy.MaxAttempts >= 0, key+".retry.maxAttempts", "must not be negative")
+	v.check(policy.BackoffBase >= 0, key+".retry.backoffBase", "must not be negative")
+	v.check(policy.BackoffCap >= policy.BackoffBase, key+".retry.backoffCap", "must not be below backoffBase")
+	v.check(policy.Jitter >= 0 && policy.Jitter <= 1, key+".retry.jitter", "must be between 0 and 1")
+
+	for _, code := range policy.RetryableStatusCodes {
+		v.check(code >= 100 && code <= 599, key+".retry.retryableStatusCodes",
+			fmt.Sprintf("%d isn't an HTTP status code", code))
+	}
+}
+
+// validateRateLimit records the problems of the rate limiting.
+func (c *Config) validateRateLimit(v *validator) {
+	v.check(c.RateLimit.IdleTimeout >= 0, "rateLimit.idleTimeout", "must not be negative")
+
+	for i, rule := range c.RateLimit.Rules {
+		ruleKey := fmt.Sprintf("rateLimit.rules[%d]", i)
+
+		v.check(rule.Route != "", ruleKey+".route", "is required")
+		v.check(rule.Rate > 0, ruleKey+".rate", "must be positive")
+		v.check(rule.Burst > 0, ruleKey+".burst", "must be positive")
+
+		switch rule.Key {
+		case ratelimit.KeyIP, ratelimit.KeyUser, ratelimit.KeyAPIKey, "":
+		default:
+			v.add(ruleKey+".key", fmt.Sprintf("unknown key %q, must be ip, user or apiKey", rule.Key))
+		}
+	}
+}
+
+// validateRoutes records the problems of the proxied routes.
+func (c *Config) validateRoutes(v *validator) {
+	for i, route := range c.Routes {
+		routeKey := fmt.Sprintf("routes[%d]", i)
+
+		v.check(strings.HasPrefix(route.Prefix, "/"), routeKey+".prefix", "must start with /")
+		v.checkURL(routeKey+".upstream", route.Upstream)
+		v.check(route.Timeout >= 0, routeKey+".timeout", "must not be negative")
+
+		if err := route.TLS.Validate(); err != nil {
+			v.add(routeKey+".tls", err.Error())
+		}
+	}
+}
+
+// validateAccessLog records the problems of the access log.
+func (c *Config) validateAccessLog(v *validator) {
+	if !c.AccessLog.Enabled {
+		return
+	}
+
+	switch c.AccessLog.Format {
+	case accesslog.FormatCommon, accesslog.FormatCombined, accesslog.FormatJSON, "":
+	default:
+		v.add("accessLog.format", fmt.Sprintf("unknown format %q, must be common, combined or json",
+			c.AccessLog.Format))
+	}
+
+	v.check(c.AccessLog.MaxSize >= 0, "accessLog.maxSize", "must not be negative")
+	v.check(c.AccessLog.MaxBackups >= 0, "accessLog.maxBackups", "must not be negative")
+}
+
+// validateTracing records the problems of the tracing.
+func (c *Config) validateTracing(v *validator) {
+	if !c.Tracing.Enabled {
+		return
+	}
+
+	switch c.Tracing.Exporter {
+	case "otlp":
+		v.checkURL("tracing.endpoint", c.Tracing.Endpoint)
+	case "stdout", "none", "":
+	default:
+		v.add("tracing.exporter", fmt.Sprintf("unknown exporter %q, must be otlp, stdout or none",
+			c.Tracing.Exporter))
+	}
+
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio",
+		"must be between 0 and 1")
+	v.check(c.Tracing.BatchSize >= 0, "tracing.batchSize", "must not be negative")
+	v.check(c.Tracing.FlushInterval >= 0, "tracing.flushInterval", "must not be negative")
+	v.check(c.Tracing.Timeout >= 0, "tracing.timeout", "must not be negative")
+}
+
+// validateServer records the problems of the API server.
+func (c *Config) validateServer(v *validator) {
+	server := c.Server
+
+	v.check(server.Address != "", "server.address", "is required")
+	v.check(server.ReadTime > 0, "server.readTime", "must be positive")
+	v.check(server.WriteTime > 0, "server.writeTime", "must be positive")
+	v.check(server.IdleTime > 0, "server.idleTime", "must be positive")
+	v.check(server.ReaderHeaderTime > 0, "server.readerHeaderTime", "must be positive")
+
+	if _, err := clientip.ParseNetworks(server.TrustedProxies); err != nil {
+		v.add("server.trustedProxies", err.Error())
+	}
+
+	if !server.TLS.Enabled {
+		return
+	}
+
+	v.checkFile("server.tls.certFile", server.TLS.CertFile)
+	v.checkFile("server.tls.keyFile", server.TLS.KeyFile)
+
+	if _, err := tlsconfig.ParseVersion(server.TLS.MinVersion); err != nil {
+		v.add("server.tls.minVersion", err.Error())
+	}
+
+	if _, err := tlsconfig.ParseCipherSuites(server.TLS.CipherSuites); err != nil {
+		v.add("server.tls.cipherSuites", err.Error())
+	}
+
+	v.check(server.TLS.ReloadInterval >= 0, "server.tls.reloadInterval", "must not be negative")
+	v.check(!server.TLS.Redirect.Enabled || server.TLS.Redirect.Address != "", "server.tls.redirect.address",
+		"is required when the redirect is enabled")
+}
+
+// validateAdmin records the problems of the admin listener.
+func (c *Config) validateAdmin(v *validator) {
+	admin := c.Admin
+
+	v.check(admin.WriteTime > 0, "admin.writeTime", "must be positive")
+
+	for name, token := range admin.Tokens {
+		v.check(len(token) >= minAdminTokenLength, "admin.tokens."+name,
+			fmt.Sprintf("must be at least %d characters long", minAdminTokenLength))
+	}
+
+	if admin.Address == "" {
+		v.add("admin.address", "is required")
+
+		return
+	}
+
+	v.check(admin.Address != c.Server.Address, "admin.address", "must differ from server.address")
+	v.check(!c.Server.TLS.Redirect.Enabled || admin.Address != c.Server.TLS.Redirect.Address, "admin.address",
+		"must differ from server.tls.redirect.address")
+}
+
+// validateMaintenance records the problems of the maintenance mode.
+func (c *Config) validateMaintenance(v *validator) {
+	mode := c.Maintenance
+
+	v.check(mode.RetryAfter >= 0, "maintenance.retryAfter", "must not be negative")
+
+	if _, err := clientip.ParseNetworks(mode.AllowedIPs); err != nil {
+		v.add("maintenance.allowedIPs", err.Error())
+	}
+
+	for _, token := range mode.BypassTokens {
+		v.check(len(token) >= minAdminTokenLength, "maintenance.bypassTokens",
+			fmt.Sprintf("must be at least %d characters long", minAdminTokenLength))
+	}
+
+	if mode.JSONFile != "" {
+		v.checkFile("maintenance.jsonFile", mode.JSONFile)
+	}
+
+	if mode.HTMLFile != "" {
+		v.checkFile("maintenance.htmlFile", mode.HTMLFile)
+	}
+}
+
+// decodeProblem rewrites a decoding error in the "key: problem" form of the other problems.
+func decodeProblem(message string) string {
+	var (
+		key, problem string
+		ok           bool
+	)
+
+	switch {
+	case strings.HasPrefix(message, "error decoding '"):
+		key, problem, ok = strings.Cut(strings.TrimPrefix(message, "error decoding '"), "': ")
+	case strings.HasPrefix(message, "cannot parse '"):
+		// cannot parse 'key' as int: ... or cannot parse 'key', -1 overflows uint
+		key, problem, ok = strings.Cut(strings.TrimPrefix(message, "cannot parse '"), "'")
+		problem = "cannot parse" + problem
+	case strings.HasPrefix(message, "'"):
+		// 'key' has invalid keys: ... or 'key' expected type ...
+		key, problem, ok = strings.Cut(strings.TrimPrefix(message, "'"), "' ")
+		if strings.HasPrefix(problem, "has invalid keys: ") {
+			problem = "unknown keys: " + strings.TrimPrefix(problem, "has invalid keys: ")
+		}
+	}
+
+	switch {
+	case !ok:
+		return message
+	case key == "":
+		return problem
+	default:
+		return key + ": " + problem
+	}
+}
+
+// validator collects the problems of the config.
+type validator struct {
+	problems []string
+}
+
+// add records the problem of the key.
+func (v *validator) add(key, problem string) {
+	v.problems = append(v.problems, key+": "+problem)
+}
+
+// check records the problem of the key unless ok.
+func (v *validator) check(ok bool, key, problem string) {
+	if !ok {
+		v.add(key, problem)
+	}
+}
+
+// checkURL records a problem unless the value is an absolute http or https url.
+func (v *validator) checkURL(key, value string) {
+	if value == "" {
+		v.add(key, "is required")
+
+		return
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		v.add(key, fmt.Sprintf("invalid url %q: %v", value, err))
+
+		return
+	}
+
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		v.add(key, fmt.Sprintf("invalid url %q, must be an absolute http or https url", value))
+	}
+}
+
+// checkFile records a problem unless the value is the path of a readable file.
+func (v *validator) checkFile(key, path string) {
+	if path == "" {
+		v.add(key, "is required")
+
+		return
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		v.add(key, err.Error())
+	}
+}
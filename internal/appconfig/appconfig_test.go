@@ -0,0 +1,250 @@
+package appconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/configreader"
+	"github.com/UArt-project/UArt-proxy/pkg/proxy"
+	"github.com/UArt-project/UArt-proxy/pkg/ratelimit"
+)
+
+// defaultConfigPath is the config shipped with the repository.
+const defaultConfigPath = "../../config.yaml"
+
+// loadFile loads the config file and decodes it.
+func loadFile(t *testing.T, path string) (*Config, error) {
+	t.Helper()
+
+	if err := configreader.Load(configreader.Options{Path: path, Schema: configreader.SchemaOf(Config{})}); err != nil {
+		t.Fatalf("loading %s: %v", path, err)
+	}
+
+	return Load(configreader.Current())
+}
+
+// problems returns the problems of the validation error.
+func problems(t *testing.T, err error) []string {
+	t.Helper()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want a *ValidationError", err)
+	}
+
+	return validationErr.Problems
+}
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if _, err := loadFile(t, defaultConfigPath); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{
+			name:   "unknown log level",
+			modify: func(c *Config) { c.Log.Level = "verbose" },
+			want:   []string{"log.level: "},
+		},
+		{
+			name:   "upstream without url and targets",
+			modify: func(c *Config) { c.Market.URL, c.Market.Targets = "", nil },
+			want:   []string{"market: either url or targets is required"},
+		},
+		{
+			name: "invalid targets",
+			modify: func(c *Config) {
+				c.Market.Targets = []TargetConfig{{URL: "market:8080"}, {URL: "http://market:8080", Weight: -1}}
+			},
+			want: []string{
+				`market.targets[0].url: invalid url "market:8080", must be an absolute http or https url`,
+				"market.targets[1].weight: must not be negative",
+			},
+		},
+		{
+			name:   "unknown balancer",
+			modify: func(c *Config) { c.Auth.Balancer = "fastest" },
+			want:   []string{"auth.balancer: "},
+		},
+		{
+			name: "invalid retry policy",
+			modify: func(c *Config) {
+				c.Market.Retry.BackoffBase = time.Second
+				c.Market.Retry.BackoffCap = time.Millisecond
+				c.Market.Retry.RetryableStatusCodes = []int{503, 42}
+			},
+			want: []string{
+				"market.retry.backoffCap: must not be below backoffBase",
+				"market.retry.retryableStatusCodes: 42 isn't an HTTP status code",
+			},
+		},
+		{
+			name:   "breaker ratio out of range",
+			modify: func(c *Config) { c.Auth.Breaker.FailureRatio = 1.5 },
+			want:   []string{"auth.breaker.failureRatio: must be between 0 and 1"},
+		},
+		{
+			name:   "missing upstream CA bundle",
+			modify: func(c *Config) { c.Market.TLS.CAFile = "missing.pem" },
+			want:   []string{"market.tls: reading the CA bundle: "},
+		},
+		{
+			name: "invalid rate limit rule",
+			modify: func(c *Config) {
+				c.RateLimit.Rules = []ratelimit.Rule{{Route: "", Rate: 0, Burst: 1, Key: "cookie"}}
+			},
+			want: []string{
+				"rateLimit.rules[0].route: is required",
+				"rateLimit.rules[0].rate: must be positive",
+				`rateLimit.rules[0].key: unknown key "cookie", must be ip, user or apiKey`,
+			},
+		},
+		{
+			name:   "invalid route",
+			modify: func(c *Config) { c.Routes = []proxy.Route{{Prefix: "static", Upstream: "ftp://files"}} },
+			want: []string{
+				"routes[0].prefix: must start with /",
+				`routes[0].upstream: invalid url "ftp://files", must be an absolute http or https url`,
+			},
+		},
+		{
+			name: "unknown tracing exporter",
+			modify: func(c *Config) {
+				c.Tracing.Enabled, c.Tracing.Exporter, c.Tracing.SampleRatio = true, "jaeger", 2
+			},
+			want: []string{
+				`tracing.exporter: unknown exporter "jaeger", must be otlp, stdout or none`,
+				"tracing.sampleRatio: must be between 0 and 1",
+			},
+		},
+		{
+			name:   "invalid trusted proxy",
+			modify: func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy"} },
+			want:   []string{"server.trustedProxies: "},
+		},
+		{
+			name: "admin sharing the server address",
+			modify: func(c *Config) {
+				c.Admin.Address = c.Server.Address
+				c.Admin.Tokens = map[string]string{"ops": "short"}
+			},
+			want: []string{"admin.tokens.ops: must be at least", "admin.address: must differ from server.address"},
+		},
+		{
+			name:   "missing admin address",
+			modify: func(c *Config) { c.Admin.Address = "" },
+			want:   []string{"admin.address: is required"},
+		},
+		{
+			name: "invalid maintenance",
+			modify: func(c *Config) {
+				c.Maintenance.AllowedIPs = []string{"10.0.0.300"}
+				c.Maintenance.JSONFile = "missing.json"
+			},
+			want: []string{"maintenance.allowedIPs: ", "maintenance.jsonFile: "},
+		},
+		{
+			name: "all the problems reported at once",
+			modify: func(c *Config) {
+				c.WorkerPoolSize = 0
+				c.Cache.TTL = -time.Second
+				c.Shutdown.DrainTimeout = 0
+			},
+			want: []string{
+				"worker_pool_size: must be between 1 and",
+				"cache.ttl: must not be negative",
+				"shutdown.drainTimeout: must be positive",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadFile(t, defaultConfigPath)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			tt.modify(cfg)
+
+			v := new(validator)
+			cfg.validate(v)
+
+			if len(v.problems) != len(tt.want) {
+				t.Fatalf("problems = %q, want %d of them", v.problems, len(tt.want))
+			}
+
+			for i, want := range tt.want {
+				if !strings.HasPrefix(v.problems[i], want) {
+					t.Errorf("problem %d = %q, want it to start with %q", i, v.problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadReportsDecodingProblems(t *testing.T) {
+	defaults, err := os.ReadFile(defaultConfigPath)
+	if err != nil {
+		t.Fatalf("reading the default config: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := strings.Replace(string(defaults), "\nworker_pool_size:", "\nunknownSection: true\nworker_pool_size:", 1)
+	content = strings.Replace(content, "\nworker_pool_size: ", "\nworker_pool_size: many #", 1)
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing the config: %v", err)
+	}
+
+	_, err = loadFile(t, path)
+	got := problems(t, err)
+
+	want := []string{"worker_pool_size: cannot parse as int: ", "unknown keys: unknownsection"}
+
+	for _, prefix := range want {
+		found := false
+
+		for _, problem := range got {
+			found = found || strings.HasPrefix(problem, prefix)
+		}
+
+		if !found {
+			t.Errorf("problems = %q, want one starting with %q", got, prefix)
+		}
+	}
+
+	if !strings.HasPrefix(err.Error(), strconv.Itoa(len(got))+" problem(s) in the config:\n  - ") {
+		t.Errorf("Error() = %q, want the problem count first", err.Error())
+	}
+}
+
+func TestDecodeProblem(t *testing.T) {
+	tests := map[string]string{
+		"'' has invalid keys: foo, bar":                   "unknown keys: foo, bar",
+		"'market' has invalid keys: timeuot":              "market: unknown keys: timeuot",
+		"error decoding 'cache.ttl': invalid":             "cache.ttl: invalid",
+		"cannot parse 'workers' as int: invalid syntax":   "workers: cannot parse as int: invalid syntax",
+		"cannot parse 'workers', -1 overflows uint":       "workers: cannot parse, -1 overflows uint",
+		"'log.level' expected type 'string', got 'slice'": "log.level: expected type 'string', got 'slice'",
+		"'unterminated":  "'unterminated",
+		"something else": "something else",
+	}
+
+	for message, want := range tests {
+		if got := decodeProblem(message); got != want {
+			t.Errorf("decodeProblem(%q) = %q, want %q", message, got, want)
+		}
+	}
+}
@@ -2,24 +2,33 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/UArt-project/UArt-proxy/domain/authdomain"
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
 	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
 	"github.com/UArt-project/UArt-proxy/pkg/cache"
 	"github.com/UArt-project/UArt-proxy/pkg/clients/authclient"
 	"github.com/UArt-project/UArt-proxy/pkg/clients/marketclient"
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+	"github.com/UArt-project/UArt-proxy/pkg/tracing"
 	"github.com/UArt-project/UArt-proxy/pkg/workerpool"
 )
 
+var errNegativePage = errors.New("the page number is negative")
+
 // AppService provides information of main application service functionality.
 type AppService interface {
 	// GetMarketPage returns a page of market items.
-	GetMarketPage(page int) ([]marketdomain.MarketItem, error)
+	GetMarketPage(ctx context.Context, page int) ([]marketdomain.MarketItem, error)
 
-	GetAuthPage() (string, error)
+	GetAuthPage(ctx context.Context) (string, error)
 
-	GetAuthToken(callbackData authdomain.CallbackRequest) (*authdomain.AuthReturn, error)
+	GetAuthToken(ctx context.Context, callbackData authdomain.CallbackRequest) (*authdomain.AuthReturn, error)
 }
 
 // Service is a main application logic.
@@ -32,39 +41,93 @@ type Service struct {
 	workerPool *workerpool.WorkerPool
 	// The cache.
 	cache *cache.LocalCache
+	// The time the market pages are cached for, in nanoseconds, caching is disabled if not positive.
+	cacheTTL *atomic.Int64
 }
 
-// NewService creates a new instance of the Service.
+// NewService creates a new instance of the Service caching the market pages for the cacheTTL.
 func NewService(marketClient marketclient.MarketClient, authClient authclient.AuthClient,
-	workerPool *workerpool.WorkerPool, cache *cache.LocalCache,
+	workerPool *workerpool.WorkerPool, cache *cache.LocalCache, cacheTTL time.Duration,
 ) *Service {
-	return &Service{
+	service := &Service{
 		marketClient: marketClient,
 		authClient:   authClient,
 		workerPool:   workerPool,
 		cache:        cache,
+		cacheTTL:     new(atomic.Int64),
 	}
+
+	service.SetCacheTTL(cacheTTL)
+
+	return service
+}
+
+// SetCacheTTL sets the time the market pages are cached for, it can be called while serving.
+// The pages cached before keep their expiry.
+func (s Service) SetCacheTTL(ttl time.Duration) {
+	s.cacheTTL.Store(int64(ttl))
 }
 
 // GetMarketPage returns a page of market items.
-func (s Service) GetMarketPage(page int) ([]marketdomain.MarketItem, error) {
-	items, err := s.cache.Read(page)
-	if err == nil && len(items) > 0 {
-		return items, nil
+func (s Service) GetMarketPage(ctx context.Context, page int) ([]marketdomain.MarketItem, error) {
+	ctx, span := tracing.Start(ctx, "service.GetMarketPage", tracing.KindInternal)
+	defer span.End()
+
+	span.SetAttribute("market.page", page)
+
+	if page < 0 {
+		return nil, errdomain.New(errdomain.ErrBadRequest, fmt.Errorf("%w: %d", errNegativePage, page))
+	}
+
+	// Caching is disabled without a TTL.
+	ttl := time.Duration(s.cacheTTL.Load())
+
+	if ttl > 0 {
+		if items, found := s.readCache(ctx, page); found {
+			requestctx.SetCacheStatus(ctx, requestctx.CacheHit)
+
+			return items, nil
+		}
+
+		requestctx.SetCacheStatus(ctx, requestctx.CacheMiss)
 	}
 
-	items, err = s.marketClient.GetPage(page)
+	items, err := s.marketClient.GetPage(ctx, page)
 	if err != nil {
+		span.RecordError(err)
+
 		return nil, fmt.Errorf("getting the page of items: %w", err)
 	}
 
+	if ttl > 0 {
+		s.cache.Update(page, items, time.Now().Add(ttl))
+	}
+
 	return items, nil
 }
 
+// readCache returns the cached page of items, reporting whether it was found.
+func (s Service) readCache(ctx context.Context, page int) ([]marketdomain.MarketItem, bool) {
+	_, span := tracing.Start(ctx, "cache.Read", tracing.KindInternal)
+	defer span.End()
+
+	items, err := s.cache.Read(page)
+	found := err == nil
+
+	span.SetAttribute("cache.hit", found)
+
+	return items, found
+}
+
 // GetAuthPage returns a auth redirection page.
-func (s Service) GetAuthPage() (string, error) {
-	url, err := s.authClient.SendAuthRequest()
+func (s Service) GetAuthPage(ctx context.Context) (string, error) {
+	ctx, span := tracing.Start(ctx, "service.GetAuthPage", tracing.KindInternal)
+	defer span.End()
+
+	url, err := s.authClient.SendAuthRequest(ctx)
 	if err != nil {
+		span.RecordError(err)
+
 		return "", fmt.Errorf("getting the auth page: %w", err)
 	}
 
@@ -72,9 +135,16 @@ func (s Service) GetAuthPage() (string, error) {
 }
 
 // GetAuthToken returns the OAuth data.
-func (s Service) GetAuthToken(callbackData authdomain.CallbackRequest) (*authdomain.AuthReturn, error) {
-	data, err := s.authClient.SendOAuthData(callbackData)
+func (s Service) GetAuthToken(ctx context.Context,
+	callbackData authdomain.CallbackRequest,
+) (*authdomain.AuthReturn, error) {
+	ctx, span := tracing.Start(ctx, "service.GetAuthToken", tracing.KindInternal)
+	defer span.End()
+
+	data, err := s.authClient.SendOAuthData(ctx, callbackData)
 	if err != nil {
+		span.RecordError(err)
+
 		return nil, fmt.Errorf("getting the OAuth data: %w", err)
 	}
 
@@ -0,0 +1,148 @@
+// Package accesslog provides a middleware logging every handled request.
+package accesslog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/clientip"
+	"github.com/UArt-project/UArt-proxy/pkg/httpx"
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+)
+
+// Formats of the access log.
+const (
+	// FormatCommon is the Common Log Format.
+	FormatCommon = "common"
+	// FormatCombined is the Combined Log Format followed by the duration and upstream latency
+	// in milliseconds, the cache status and the request ID.
+	FormatCombined = "combined"
+	// FormatJSON writes a JSON object per request.
+	FormatJSON = "json"
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+var errUnknownFormat = errors.New("unknown access log format")
+
+// Entry is a record of a handled request.
+type Entry struct {
+	Time              time.Time `json:"time"`
+	RequestID         string    `json:"requestId,omitempty"`
+	ClientIP          string    `json:"clientIp"`
+	Method            string    `json:"method"`
+	Path              string    `json:"path"`
+	Protocol          string    `json:"protocol"`
+	Status            int       `json:"status"`
+	Bytes             int64     `json:"bytes"`
+	DurationMs        float64   `json:"durationMs"`
+	UpstreamLatencyMs float64   `json:"upstreamLatencyMs"`
+	Cache             string    `json:"cache,omitempty"`
+	Referer           string    `json:"referer,omitempty"`
+	UserAgent         string    `json:"userAgent,omitempty"`
+}
+
+// Logger writes the access log entries in the configured format.
+type Logger struct {
+	output   io.Writer
+	format   string
+	resolver *clientip.Resolver
+}
+
+// NewLogger creates a new instance of the Logger, the IP addresses of the clients are resolved with the resolver.
+func NewLogger(output io.Writer, format string, resolver *clientip.Resolver) (*Logger, error) {
+	switch format {
+	case FormatCommon, FormatCombined, FormatJSON:
+	case "":
+		format = FormatCombined
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownFormat, format)
+	}
+
+	return &Logger{
+		output:   output,
+		format:   format,
+		resolver: resolver,
+	}, nil
+}
+
+// Middleware logs every request handled by the next handler.
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ctx, stats := requestctx.WithStats(req.Context())
+		recorder := httpx.NewRecorder(w)
+
+		next.ServeHTTP(recorder, req.WithContext(ctx))
+
+		l.write(Entry{
+			Time:              start,
+			RequestID:         requestctx.RequestID(ctx),
+			ClientIP:          l.resolver.IP(req),
+			Method:            req.Method,
+			Path:              req.URL.Path,
+			Protocol:          req.Proto,
+			Status:            recorder.Status(),
+			Bytes:             recorder.Bytes(),
+			DurationMs:        milliseconds(time.Since(start)),
+			UpstreamLatencyMs: milliseconds(stats.UpstreamLatency()),
+			Cache:             stats.CacheStatus(),
+			Referer:           req.Referer(),
+			UserAgent:         req.UserAgent(),
+		})
+	})
+}
+
+// write formats the entry and writes it to the output.
+func (l *Logger) write(entry Entry) {
+	var line []byte
+
+	switch l.format {
+	case FormatJSON:
+		encData, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+
+		line = append(encData, '\n')
+	case FormatCommon:
+		line = []byte(commonLine(entry) + "\n")
+	default:
+		line = []byte(fmt.Sprintf("%s %q %q %.3f %.3f %s %s\n", commonLine(entry),
+			dashIfEmpty(entry.Referer), dashIfEmpty(entry.UserAgent), entry.DurationMs, entry.UpstreamLatencyMs,
+			dashIfEmpty(entry.Cache), dashIfEmpty(entry.RequestID)))
+	}
+
+	_, _ = l.output.Write(line)
+}
+
+// commonLine formats the entry in the Common Log Format.
+func commonLine(entry Entry) string {
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.FormatInt(entry.Bytes, 10)
+	}
+
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s", entry.ClientIP, entry.Time.Format(clfTimeLayout),
+		entry.Method, entry.Path, entry.Protocol, entry.Status, bytes)
+}
+
+// milliseconds returns the duration in fractional milliseconds.
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
+
+// dashIfEmpty returns the value or a dash if it's empty.
+func dashIfEmpty(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "-"
+	}
+
+	return value
+}
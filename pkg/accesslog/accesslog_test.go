@@ -0,0 +1,53 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/UArt-project/UArt-proxy/pkg/clientip"
+)
+
+func TestMiddlewareClientIP(t *testing.T) {
+	resolver, err := clientip.NewResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{name: "client behind a trusted proxy", remoteAddr: "10.0.0.1:4321", want: "198.51.100.1"},
+		{name: "untrusted peer", remoteAddr: "203.0.113.7:4321", want: "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := new(bytes.Buffer)
+
+			accessLogger, err := NewLogger(output, FormatJSON, resolver)
+			if err != nil {
+				t.Fatalf("NewLogger() error = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/market/1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+			accessLogger.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry Entry
+			if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+				t.Fatalf("decoding the entry %q: %v", output.String(), err)
+			}
+
+			if entry.ClientIP != tt.want || entry.Status != http.StatusNotFound {
+				t.Errorf("client IP, status = %s, %d, want %s, %d", entry.ClientIP, entry.Status, tt.want, http.StatusNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+// Package balancer provides load balancing strategies over upstream targets.
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the supported balancing strategies.
+const (
+	RoundRobin       = "round-robin"
+	Weighted         = "weighted"
+	LeastOutstanding = "least-outstanding"
+	RandomTwoChoices = "random-two-choices"
+)
+
+var (
+	// ErrNoTargets is returned when there is no target to send a request to.
+	ErrNoTargets = errors.New("no upstream targets available")
+
+	errUnknownStrategy = errors.New("unknown balancing strategy")
+	errEmptyTargetURL  = errors.New("the target url is empty")
+)
+
+// Target is a single instance of an upstream service.
+type Target struct {
+	// URL is the base url of the instance.
+	URL *url.URL
+	// Weight is the relative share of requests sent to the instance.
+	Weight int
+	// outstanding is the number of requests in flight.
+	outstanding atomic.Int64
+	// ejected is set while the target is taken out of rotation.
+	ejected atomic.Bool
+	// drained is set while an operator keeps the target out of rotation.
+	drained atomic.Bool
+	// currentWeight is used by the weighted strategy.
+	currentWeight int
+}
+
+// NewTarget creates a new instance of the Target.
+func NewTarget(rawURL string, weight int) (*Target, error) {
+	if rawURL == "" {
+		return nil, errEmptyTargetURL
+	}
+
+	targetURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the target url: %w", err)
+	}
+
+	if weight < 1 {
+		weight = 1
+	}
+
+	return &Target{
+		URL:    targetURL,
+		Weight: weight,
+	}, nil
+}
+
+// Acquire marks the start of a request to the target.
+func (t *Target) Acquire() {
+	t.outstanding.Add(1)
+}
+
+// Release marks the end of a request to the target.
+func (t *Target) Release() {
+	t.outstanding.Add(-1)
+}
+
+// Outstanding returns the number of requests in flight to the target.
+func (t *Target) Outstanding() int64 {
+	return t.outstanding.Load()
+}
+
+// Healthy reports whether the target is in rotation.
+func (t *Target) Healthy() bool {
+	return !t.ejected.Load()
+}
+
+// Eject takes the target out of rotation, it reports whether the target was healthy before.
+func (t *Target) Eject() bool {
+	return t.ejected.CompareAndSwap(false, true)
+}
+
+// Admit returns the target to rotation, it reports whether the target was ejected before.
+func (t *Target) Admit() bool {
+	return t.ejected.CompareAndSwap(true, false)
+}
+
+// Drained reports whether the target is kept out of rotation by an operator.
+func (t *Target) Drained() bool {
+	return t.drained.Load()
+}
+
+// Drain keeps the target out of rotation until Undrain, whatever its health is.
+// The requests in flight complete. It reports whether the target wasn't drained before.
+func (t *Target) Drain() bool {
+	return t.drained.CompareAndSwap(false, true)
+}
+
+// Undrain returns the drained target to rotation, it reports whether the target was drained before.
+func (t *Target) Undrain() bool {
+	return t.drained.CompareAndSwap(true, false)
+}
+
+// Balancer selects a target for every request.
+type Balancer interface {
+	// Next returns the target for the next request.
+	Next() (*Target, error)
+	// Targets returns all the targets of the balancer.
+	Targets() []*Target
+}
+
+// New creates a balancer with the specified strategy.
+func New(strategy string, targets []*Target) (Balancer, error) {
+	base := pool{
+		mu:      new(sync.RWMutex),
+		targets: targets,
+	}
+
+	switch strategy {
+	case RoundRobin, "":
+		return &roundRobin{pool: base}, nil
+	case Weighted:
+		return &weighted{pool: base}, nil
+	case LeastOutstanding:
+		return &leastOutstanding{pool: base}, nil
+	case RandomTwoChoices:
+		return &randomTwoChoices{
+			pool: base,
+			rnd:  rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownStrategy, strategy)
+	}
+}
+
+// pool holds the targets shared by all strategies.
+type pool struct {
+	mu      *sync.RWMutex
+	targets []*Target
+}
+
+// Targets returns all the targets of the balancer.
+func (p *pool) Targets() []*Target {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	targets := make([]*Target, len(p.targets))
+	copy(targets, p.targets)
+
+	return targets
+}
+
+// available returns the healthy targets of the balancer, the drained targets are never returned.
+// All the targets not drained are returned if none of them is healthy,
+// so a misbehaving health check can't take the whole upstream down.
+func (p *pool) available() []*Target {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	targets := make([]*Target, 0, len(p.targets))
+	undrained := make([]*Target, 0, len(p.targets))
+
+	for _, target := range p.targets {
+		if target.Drained() {
+			continue
+		}
+
+		undrained = append(undrained, target)
+
+		if target.Healthy() {
+			targets = append(targets, target)
+		}
+	}
+
+	if len(targets) == 0 {
+		targets = undrained
+	}
+
+	return targets
+}
+
+// roundRobin sends requests to the targets in turn.
+type roundRobin struct {
+	pool
+	counter atomic.Uint64
+}
+
+// Next returns the target for the next request.
+func (b *roundRobin) Next() (*Target, error) {
+	targets := b.available()
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	idx := (b.counter.Add(1) - 1) % uint64(len(targets))
+
+	return targets[idx], nil
+}
+
+// weighted sends requests to the targets in proportion to their weights
+// using the smooth weighted round-robin algorithm.
+type weighted struct {
+	pool
+	weightMu sync.Mutex
+}
+
+// Next returns the target for the next request.
+func (b *weighted) Next() (*Target, error) {
+	targets := b.available()
+
+	b.weightMu.Lock()
+	defer b.weightMu.Unlock()
+
+	var (
+		best        *Target
+		totalWeight int
+	)
+
+	for _, target := range targets {
+		target.currentWeight += target.Weight
+		totalWeight += target.Weight
+
+		if best == nil || target.currentWeight > best.currentWeight {
+			best = target
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoTargets
+	}
+
+	best.currentWeight -= totalWeight
+
+	return best, nil
+}
+
+// leastOutstanding sends requests to the target with the fewest requests in flight,
+// ties are broken in round-robin order.
+type leastOutstanding struct {
+	pool
+	counter atomic.Uint64
+}
+
+// Next returns the target for the next request.
+func (b *leastOutstanding) Next() (*Target, error) {
+	var best *Target
+
+	targets := b.available()
+	start := b.counter.Add(1) - 1
+
+	for i := range targets {
+		target := targets[(start+uint64(i))%uint64(len(targets))]
+
+		if best == nil || target.Outstanding() < best.Outstanding() {
+			best = target
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoTargets
+	}
+
+	return best, nil
+}
+
+// randomTwoChoices picks two random targets and sends the request
+// to the one with fewer requests in flight.
+type randomTwoChoices struct {
+	pool
+	rndMu sync.Mutex
+	rnd   *rand.Rand
+}
+
+// Next returns the target for the next request.
+func (b *randomTwoChoices) Next() (*Target, error) {
+	targets := b.available()
+
+	switch len(targets) {
+	case 0:
+		return nil, ErrNoTargets
+	case 1:
+		return targets[0], nil
+	}
+
+	b.rndMu.Lock()
+	first := b.rnd.Intn(len(targets))
+	second := b.rnd.Intn(len(targets) - 1)
+	b.rndMu.Unlock()
+
+	if second >= first {
+		second++
+	}
+
+	if targets[second].Outstanding() < targets[first].Outstanding() {
+		return targets[second], nil
+	}
+
+	return targets[first], nil
+}
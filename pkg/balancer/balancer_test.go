@@ -0,0 +1,323 @@
+package balancer
+
+import (
+	"errors"
+	"testing"
+)
+
+// newTargets creates the targets of the urls with the weights.
+func newTargets(t *testing.T, weights map[string]int, urls ...string) []*Target {
+	t.Helper()
+
+	targets := make([]*Target, 0, len(urls))
+
+	for _, rawURL := range urls {
+		target, err := NewTarget(rawURL, weights[rawURL])
+		if err != nil {
+			t.Fatalf("creating the target %s: %v", rawURL, err)
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+// picks returns the urls of the targets picked by n calls of Next.
+func picks(t *testing.T, bal Balancer, n int) []string {
+	t.Helper()
+
+	urls := make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		target, err := bal.Next()
+		if err != nil {
+			t.Fatalf("picking the target %d: %v", i, err)
+		}
+
+		urls = append(urls, target.URL.String())
+	}
+
+	return urls
+}
+
+// count returns the number of occurrences of every url.
+func count(urls []string) map[string]int {
+	counts := make(map[string]int, len(urls))
+
+	for _, u := range urls {
+		counts[u]++
+	}
+
+	return counts
+}
+
+func TestNewUnknownStrategy(t *testing.T) {
+	if _, err := New("fastest", nil); !errors.Is(err, errUnknownStrategy) {
+		t.Fatalf("New() error = %v, want %v", err, errUnknownStrategy)
+	}
+}
+
+func TestNewTarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		weight     int
+		wantWeight int
+		wantErr    bool
+	}{
+		{name: "weight kept", url: "http://a:8080", weight: 3, wantWeight: 3},
+		{name: "zero weight defaults to one", url: "http://a:8080", weight: 0, wantWeight: 1},
+		{name: "negative weight defaults to one", url: "http://a:8080", weight: -2, wantWeight: 1},
+		{name: "empty url", url: "", wantErr: true},
+		{name: "invalid url", url: "http://a:port", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := NewTarget(tt.url, tt.weight)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTarget() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if err == nil && target.Weight != tt.wantWeight {
+				t.Errorf("NewTarget() weight = %d, want %d", target.Weight, tt.wantWeight)
+			}
+		})
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	urls := []string{"http://a", "http://b", "http://c"}
+
+	tests := []struct {
+		name     string
+		strategy string
+		weights  map[string]int
+		calls    int
+		want     map[string]int
+	}{
+		{
+			name:     "round robin spreads evenly",
+			strategy: RoundRobin,
+			calls:    9,
+			want:     map[string]int{"http://a": 3, "http://b": 3, "http://c": 3},
+		},
+		{
+			name:     "empty strategy is round robin",
+			strategy: "",
+			calls:    6,
+			want:     map[string]int{"http://a": 2, "http://b": 2, "http://c": 2},
+		},
+		{
+			name:     "weighted follows the weights",
+			strategy: Weighted,
+			weights:  map[string]int{"http://a": 5, "http://b": 1, "http://c": 1},
+			calls:    14,
+			want:     map[string]int{"http://a": 10, "http://b": 2, "http://c": 2},
+		},
+		{
+			name:     "least outstanding spreads evenly without load",
+			strategy: LeastOutstanding,
+			calls:    6,
+			want:     map[string]int{"http://a": 2, "http://b": 2, "http://c": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bal, err := New(tt.strategy, newTargets(t, tt.weights, urls...))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			got := count(picks(t, bal, tt.calls))
+
+			for u, want := range tt.want {
+				if got[u] != want {
+					t.Errorf("target %s picked %d times, want %d (all picks %v)", u, got[u], want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundRobinOrder(t *testing.T) {
+	bal, err := New(RoundRobin, newTargets(t, nil, "http://a", "http://b"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got := picks(t, bal, 4)
+	want := []string{"http://a", "http://b", "http://a", "http://b"}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("picks = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLeastOutstandingPicksTheIdleTarget(t *testing.T) {
+	targets := newTargets(t, nil, "http://a", "http://b", "http://c")
+	targets[0].Acquire()
+	targets[2].Acquire()
+	targets[2].Acquire()
+
+	bal, err := New(LeastOutstanding, targets)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i, u := range picks(t, bal, 3) {
+		if u != "http://b" {
+			t.Errorf("pick %d = %s, want http://b", i, u)
+		}
+	}
+}
+
+func TestRandomTwoChoicesAvoidsTheBusierTarget(t *testing.T) {
+	targets := newTargets(t, nil, "http://a", "http://b")
+	targets[0].Acquire()
+
+	bal, err := New(RandomTwoChoices, targets)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// With two targets both are always compared, so the idle one always wins.
+	for i, u := range picks(t, bal, 10) {
+		if u != "http://b" {
+			t.Errorf("pick %d = %s, want http://b", i, u)
+		}
+	}
+}
+
+func TestAvailability(t *testing.T) {
+	strategies := []string{RoundRobin, Weighted, LeastOutstanding, RandomTwoChoices}
+
+	tests := []struct {
+		name    string
+		ejected []int
+		drained []int
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "ejected targets are skipped",
+			ejected: []int{0},
+			want:    []string{"http://b", "http://c"},
+		},
+		{
+			name:    "drained targets are skipped",
+			drained: []int{1},
+			want:    []string{"http://a", "http://c"},
+		},
+		{
+			name:    "all ejected falls back to all the targets",
+			ejected: []int{0, 1, 2},
+			want:    []string{"http://a", "http://b", "http://c"},
+		},
+		{
+			name:    "all ejected falls back to the targets not drained",
+			ejected: []int{0, 1, 2},
+			drained: []int{2},
+			want:    []string{"http://a", "http://b"},
+		},
+		{
+			name:    "healthy target wins over the ejected ones with one drained",
+			ejected: []int{0, 1},
+			drained: []int{0},
+			want:    []string{"http://c"},
+		},
+		{
+			name:    "all drained leaves no target",
+			drained: []int{0, 1, 2},
+			wantErr: ErrNoTargets,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, strategy := range strategies {
+			t.Run(tt.name+"/"+strategy, func(t *testing.T) {
+				targets := newTargets(t, nil, "http://a", "http://b", "http://c")
+
+				for _, i := range tt.ejected {
+					targets[i].Eject()
+				}
+
+				for _, i := range tt.drained {
+					targets[i].Drain()
+				}
+
+				bal, err := New(strategy, targets)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				if tt.wantErr != nil {
+					if _, err := bal.Next(); !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Next() error = %v, want %v", err, tt.wantErr)
+					}
+
+					return
+				}
+
+				got := count(picks(t, bal, 12))
+
+				for u := range got {
+					if !contains(tt.want, u) {
+						t.Errorf("picked %s, want only %v", u, tt.want)
+					}
+				}
+
+				if strategy != RandomTwoChoices && len(got) != len(tt.want) {
+					t.Errorf("picked %v, want all of %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestEjectAdmitDrainUndrain(t *testing.T) {
+	target := newTargets(t, nil, "http://a")[0]
+
+	steps := []struct {
+		name        string
+		action      func() bool
+		wantChanged bool
+		wantHealthy bool
+		wantDrained bool
+	}{
+		{name: "eject", action: target.Eject, wantChanged: true, wantHealthy: false},
+		{name: "eject again", action: target.Eject, wantChanged: false, wantHealthy: false},
+		{name: "admit", action: target.Admit, wantChanged: true, wantHealthy: true},
+		{name: "admit again", action: target.Admit, wantChanged: false, wantHealthy: true},
+		{name: "drain", action: target.Drain, wantChanged: true, wantHealthy: true, wantDrained: true},
+		{name: "drain again", action: target.Drain, wantChanged: false, wantHealthy: true, wantDrained: true},
+		{name: "undrain", action: target.Undrain, wantChanged: true, wantHealthy: true},
+		{name: "undrain again", action: target.Undrain, wantChanged: false, wantHealthy: true},
+	}
+
+	for _, step := range steps {
+		if changed := step.action(); changed != step.wantChanged {
+			t.Errorf("%s: changed = %t, want %t", step.name, changed, step.wantChanged)
+		}
+
+		if target.Healthy() != step.wantHealthy || target.Drained() != step.wantDrained {
+			t.Errorf("%s: healthy = %t, drained = %t, want %t, %t", step.name,
+				target.Healthy(), target.Drained(), step.wantHealthy, step.wantDrained)
+		}
+	}
+}
+
+// contains reports whether the urls contain the url.
+func contains(urls []string, u string) bool {
+	for _, candidate := range urls {
+		if candidate == u {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,21 +2,43 @@ package cache
 
 import (
 	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
 )
 
-var errUserNotInCache = errors.New("the user isn't in cache")
+var errPageNotInCache = errors.New("the page isn't in cache")
+
+// Stats counts the cache lookups and evictions.
+type Stats struct {
+	Hits      atomic.Int64
+	Misses    atomic.Int64
+	Evictions atomic.Int64
+}
+
+// Entry is a cached market page.
+type Entry struct {
+	// The number of the page.
+	Page int
+	// The items of the page.
+	Items []marketdomain.MarketItem
+	// The time the page expires at.
+	ExpireAt time.Time
+}
 
 type cachedMarketPage struct {
-	items             []marketdomain.MarketItem
-	expireAtTimestamp int64
+	items    []marketdomain.MarketItem
+	expireAt time.Time
 }
 
 type LocalCache struct {
+	running     *atomic.Bool
+	stats       *Stats
 	stop        chan struct{}
+	intervals   chan time.Duration
 	wg          *sync.WaitGroup
 	mu          *sync.RWMutex
 	marketItems map[int]cachedMarketPage
@@ -24,16 +46,21 @@ type LocalCache struct {
 
 func NewLocalCache(cleanupInterval time.Duration) *LocalCache {
 	localCache := &LocalCache{
+		running:     new(atomic.Bool),
+		stats:       new(Stats),
 		stop:        make(chan struct{}),
+		intervals:   make(chan time.Duration),
 		wg:          new(sync.WaitGroup),
 		mu:          new(sync.RWMutex),
 		marketItems: make(map[int]cachedMarketPage),
 	}
 
 	localCache.wg.Add(1)
+	localCache.running.Store(true)
 
 	go func(cleanupInterval time.Duration) {
 		defer localCache.wg.Done()
+		defer localCache.running.Store(false)
 		localCache.cleanupLoop(cleanupInterval)
 	}(cleanupInterval)
 
@@ -49,12 +76,17 @@ func (lc *LocalCache) cleanupLoop(interval time.Duration) {
 		select {
 		case <-lc.stop:
 			return
+		case interval := <-lc.intervals:
+			ticker.Reset(interval)
 		case <-ticker.C:
 			lc.mu.Lock()
 
+			now := time.Now()
+
 			for uid, cu := range lc.marketItems {
-				if cu.expireAtTimestamp <= time.Now().Unix() {
+				if !cu.expireAt.After(now) {
 					delete(lc.marketItems, uid)
+					lc.stats.Evictions.Add(1)
 				}
 			}
 
@@ -63,37 +95,129 @@ func (lc *LocalCache) cleanupLoop(interval time.Duration) {
 	}
 }
 
-func (lc *LocalCache) stopCleanup() { //nolint:unused
+// Stats returns the hit, miss and eviction counters of the cache.
+func (lc *LocalCache) Stats() *Stats {
+	return lc.stats
+}
+
+// Len returns the number of cached pages.
+func (lc *LocalCache) Len() int {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+
+	return len(lc.marketItems)
+}
+
+// Running reports whether the cleanup loop of the cache is running.
+func (lc *LocalCache) Running() bool {
+	return lc.running.Load()
+}
+
+// SetCleanupInterval changes the interval of the cleanup loop, non-positive intervals are ignored.
+func (lc *LocalCache) SetCleanupInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	select {
+	case lc.intervals <- interval:
+	case <-lc.stop:
+	}
+}
+
+// Stop stops the cleanup loop and waits for it to exit.
+func (lc *LocalCache) Stop() {
 	close(lc.stop)
 
 	lc.wg.Wait()
 }
 
-func (lc *LocalCache) Update(pageID int, mItems []marketdomain.MarketItem, expireAtTimestamp int64) {
+// Update caches the page until expireAt.
+func (lc *LocalCache) Update(pageID int, mItems []marketdomain.MarketItem, expireAt time.Time) {
 	lc.mu.Lock()
 	defer lc.mu.Unlock()
 
 	lc.marketItems[pageID] = cachedMarketPage{
-		items:             mItems,
-		expireAtTimestamp: expireAtTimestamp,
+		items:    mItems,
+		expireAt: expireAt,
 	}
 }
 
+// Read returns the cached page, the expired pages are missing even before the cleanup removes them.
 func (lc *LocalCache) Read(id int) ([]marketdomain.MarketItem, error) {
 	lc.mu.RLock()
 	defer lc.mu.RUnlock()
 
 	cu, ok := lc.marketItems[id]
-	if !ok {
-		return nil, errUserNotInCache
+	if !ok || !cu.expireAt.After(time.Now()) {
+		lc.stats.Misses.Add(1)
+
+		return nil, errPageNotInCache
 	}
 
+	lc.stats.Hits.Add(1)
+
 	return cu.items, nil
 }
 
-func (lc *LocalCache) delete(id int) { //nolint:unused
+// Entries returns the cached pages ordered by the page number, without counting them as lookups.
+func (lc *LocalCache) Entries() []Entry {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(lc.marketItems))
+
+	for id, page := range lc.marketItems {
+		entries = append(entries, page.entry(id))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Page < entries[j].Page
+	})
+
+	return entries
+}
+
+// Entry returns the cached page with the specified number, without counting it as a lookup.
+func (lc *LocalCache) Entry(id int) (Entry, bool) {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+
+	page, ok := lc.marketItems[id]
+	if !ok {
+		return Entry{}, false
+	}
+
+	return page.entry(id), true
+}
+
+// Delete removes the page with the specified number, it reports whether the page was cached.
+func (lc *LocalCache) Delete(id int) bool {
 	lc.mu.Lock()
 	defer lc.mu.Unlock()
 
+	_, ok := lc.marketItems[id]
 	delete(lc.marketItems, id)
+
+	return ok
+}
+
+// Purge removes all the pages and returns their number.
+func (lc *LocalCache) Purge() int {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	purged := len(lc.marketItems)
+	lc.marketItems = make(map[int]cachedMarketPage)
+
+	return purged
+}
+
+// entry returns the page as the Entry with the specified number.
+func (cp cachedMarketPage) entry(id int) Entry {
+	return Entry{
+		Page:     id,
+		Items:    cp.items,
+		ExpireAt: cp.expireAt,
+	}
 }
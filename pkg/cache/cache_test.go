@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
+)
+
+// newTestCache creates a cache stopped at the end of the test.
+func newTestCache(t *testing.T, cleanupInterval time.Duration) *LocalCache {
+	t.Helper()
+
+	localCache := NewLocalCache(cleanupInterval)
+	t.Cleanup(localCache.Stop)
+
+	return localCache
+}
+
+var testItems = []marketdomain.MarketItem{{ID: "1", Name: "Poster", Price: 10}} //nolint:gochecknoglobals
+
+func TestReadExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		expireAt func(now time.Time) time.Time
+		wantHit  bool
+	}{
+		{name: "fresh page", expireAt: func(now time.Time) time.Time { return now.Add(time.Hour) }, wantHit: true},
+		{name: "expired page", expireAt: func(now time.Time) time.Time { return now.Add(-time.Second) }},
+		{name: "page expiring now", expireAt: func(now time.Time) time.Time { return now }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The cleanup never runs during the test, the expired pages are still stored.
+			localCache := newTestCache(t, time.Hour)
+			localCache.Update(1, testItems, tt.expireAt(time.Now()))
+
+			items, err := localCache.Read(1)
+
+			if tt.wantHit {
+				if err != nil || len(items) != len(testItems) {
+					t.Fatalf("Read() = %v, %v, want the cached items", items, err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, errPageNotInCache) {
+				t.Fatalf("Read() error = %v, want %v", err, errPageNotInCache)
+			}
+
+			if localCache.Len() != 1 {
+				t.Errorf("Len() = %d, want the expired page kept until the cleanup", localCache.Len())
+			}
+		})
+	}
+}
+
+func TestReadMissingPage(t *testing.T) {
+	localCache := newTestCache(t, time.Hour)
+
+	if _, err := localCache.Read(7); !errors.Is(err, errPageNotInCache) {
+		t.Fatalf("Read() error = %v, want %v", err, errPageNotInCache)
+	}
+}
+
+func TestStats(t *testing.T) {
+	localCache := newTestCache(t, time.Hour)
+	localCache.Update(1, testItems, time.Now().Add(time.Hour))
+	localCache.Update(2, testItems, time.Now().Add(-time.Second))
+
+	_, _ = localCache.Read(1)
+	_, _ = localCache.Read(1)
+	_, _ = localCache.Read(2)
+	_, _ = localCache.Read(3)
+
+	// The admin listing doesn't count as lookups.
+	_ = localCache.Entries()
+	_, _ = localCache.Entry(1)
+
+	stats := localCache.Stats()
+	if stats.Hits.Load() != 2 || stats.Misses.Load() != 2 {
+		t.Errorf("hits, misses = %d, %d, want 2, 2", stats.Hits.Load(), stats.Misses.Load())
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	localCache := newTestCache(t, 10*time.Millisecond)
+	localCache.Update(1, testItems, time.Now().Add(time.Hour))
+	localCache.Update(2, testItems, time.Now())
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for localCache.Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Len() = %d, want the expired page removed", localCache.Len())
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, ok := localCache.Entry(1); !ok {
+		t.Error("the fresh page was removed")
+	}
+
+	if got := localCache.Stats().Evictions.Load(); got != 1 {
+		t.Errorf("evictions = %d, want 1", got)
+	}
+}
+
+func TestEntriesDeleteAndPurge(t *testing.T) {
+	localCache := newTestCache(t, time.Hour)
+
+	for _, page := range []int{3, 1, 2} {
+		localCache.Update(page, testItems, time.Now().Add(time.Hour))
+	}
+
+	entries := localCache.Entries()
+	if len(entries) != 3 || entries[0].Page != 1 || entries[2].Page != 3 {
+		t.Fatalf("Entries() = %+v, want the pages 1 to 3 in order", entries)
+	}
+
+	if !localCache.Delete(2) || localCache.Delete(2) {
+		t.Error("Delete() reports the page deleted twice")
+	}
+
+	if purged := localCache.Purge(); purged != 2 || localCache.Len() != 0 {
+		t.Errorf("Purge() = %d with %d left, want 2 with none left", purged, localCache.Len())
+	}
+}
+
+func TestStop(t *testing.T) {
+	localCache := NewLocalCache(time.Hour)
+
+	if !localCache.Running() {
+		t.Fatal("Running() = false before Stop")
+	}
+
+	localCache.SetCleanupInterval(time.Minute)
+	localCache.Stop()
+
+	if localCache.Running() {
+		t.Error("Running() = true after Stop")
+	}
+
+	// Changing the interval of a stopped cache doesn't block.
+	localCache.SetCleanupInterval(time.Minute)
+}
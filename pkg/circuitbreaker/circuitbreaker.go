@@ -0,0 +1,285 @@
+// Package circuitbreaker provides a circuit breaker failing fast when a dependency is down.
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// bucketsPerWindow is the number of buckets the rolling window is split into.
+	bucketsPerWindow = 10
+
+	defaultFailureRatio = 0.5
+	defaultWindow       = 30 * time.Second
+	defaultCooldown     = 15 * time.Second
+)
+
+// ErrOpen is returned while the circuit breaker rejects calls.
+var ErrOpen = errors.New("the circuit breaker is open")
+
+// State is the state of a circuit breaker.
+type State int
+
+// States of a circuit breaker.
+const (
+	// Closed lets all the calls through.
+	Closed State = iota
+	// Open rejects all the calls.
+	Open
+	// HalfOpen lets a limited number of trial calls through.
+	HalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// OpenError is returned while the circuit breaker rejects calls.
+type OpenError struct {
+	// The name of the circuit breaker.
+	Name string
+	// The time left until the circuit breaker lets trial calls through.
+	RetryAfter time.Duration
+}
+
+// Error returns the error message.
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %v, retry after %s", e.Name, ErrOpen, e.RetryAfter)
+}
+
+// Is reports whether the target is ErrOpen.
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen //nolint:errorlint,goerr113
+}
+
+// Config consists of the circuit breaker options.
+type Config struct {
+	// FailureRatio is the ratio of failed calls within the window opening the circuit.
+	FailureRatio float64 `mapstructure:"failureRatio"`
+	// Window is the rolling period the failure ratio is calculated over.
+	Window time.Duration `mapstructure:"window"`
+	// MinRequests is the number of calls within the window needed before the circuit can open.
+	MinRequests int `mapstructure:"minRequests"`
+	// Cooldown is the time the circuit stays open before letting trial calls through.
+	Cooldown time.Duration `mapstructure:"cooldown"`
+	// HalfOpenRequests is the number of trial calls let through in the half-open state.
+	HalfOpenRequests int `mapstructure:"halfOpenRequests"`
+}
+
+// Ticket is handed out for an allowed call, so its result is recorded against the state it was allowed in.
+type Ticket struct {
+	// The generation of the state the call was allowed in.
+	generation uint64
+	// Whether the call is a trial of the half-open state.
+	trial bool
+}
+
+// bucket counts the calls within a part of the window.
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// Breaker is a circuit breaker with the closed, open and half-open states.
+type Breaker struct {
+	mu       *sync.Mutex
+	name     string
+	config   Config
+	state    State
+	openedAt time.Time
+	buckets  [bucketsPerWindow]bucket
+	// Incremented on every state change, the results of the calls allowed in a past state are ignored.
+	generation uint64
+	// The number of trial calls allowed in the half-open state.
+	trials int
+	// The number of successful trial calls in the half-open state.
+	successes int
+}
+
+// New creates a new instance of the Breaker.
+func New(name string, config Config) *Breaker {
+	if config.FailureRatio <= 0 || config.FailureRatio > 1 {
+		config.FailureRatio = defaultFailureRatio
+	}
+
+	if config.Window <= 0 {
+		config.Window = defaultWindow
+	}
+
+	if config.MinRequests < 1 {
+		config.MinRequests = 1
+	}
+
+	if config.Cooldown <= 0 {
+		config.Cooldown = defaultCooldown
+	}
+
+	if config.HalfOpenRequests < 1 {
+		config.HalfOpenRequests = 1
+	}
+
+	return &Breaker{
+		mu:     new(sync.Mutex),
+		name:   name,
+		config: config,
+	}
+}
+
+// Name returns the name of the circuit breaker.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state of the circuit breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState(time.Now())
+}
+
+// Allow reports whether a call may proceed, it returns an *OpenError if not.
+// Every allowed call must be followed by Record with the returned ticket.
+// The half-open state lets HalfOpenRequests trial calls through and closes once all of them succeed.
+func (b *Breaker) Allow() (Ticket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	switch b.currentState(now) {
+	case Closed:
+		return Ticket{generation: b.generation}, nil
+	case HalfOpen:
+		if b.state == Open {
+			b.halfOpen()
+		}
+
+		if b.trials < b.config.HalfOpenRequests {
+			b.trials++
+
+			return Ticket{generation: b.generation, trial: true}, nil
+		}
+
+		return Ticket{}, &OpenError{Name: b.name, RetryAfter: time.Second}
+	default:
+		return Ticket{}, &OpenError{Name: b.name, RetryAfter: b.openedAt.Add(b.config.Cooldown).Sub(now)}
+	}
+}
+
+// Record records the result of the call allowed with the ticket.
+// The results of the calls allowed before the last state change are ignored.
+func (b *Breaker) Record(ticket Ticket, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	if ticket.generation != b.generation {
+		return
+	}
+
+	if ticket.trial {
+		if failed {
+			b.open(now)
+
+			return
+		}
+
+		b.successes++
+
+		if b.successes >= b.config.HalfOpenRequests {
+			b.close()
+		}
+
+		return
+	}
+
+	current := b.bucket(now)
+	current.total++
+
+	if failed {
+		current.failures++
+	}
+
+	total, failures := b.counts(now)
+	if total >= b.config.MinRequests && float64(failures)/float64(total) >= b.config.FailureRatio {
+		b.open(now)
+	}
+}
+
+// currentState returns the state, moving an open circuit to half-open once the cooldown is over.
+func (b *Breaker) currentState(now time.Time) State {
+	if b.state == Open && now.Sub(b.openedAt) >= b.config.Cooldown {
+		return HalfOpen
+	}
+
+	return b.state
+}
+
+// open moves the circuit to the open state.
+func (b *Breaker) open(now time.Time) {
+	b.state = Open
+	b.openedAt = now
+	b.generation++
+}
+
+// halfOpen moves the circuit to the half-open state with no trial call allowed yet.
+func (b *Breaker) halfOpen() {
+	b.state = HalfOpen
+	b.trials = 0
+	b.successes = 0
+	b.generation++
+}
+
+// close moves the circuit to the closed state and forgets the past calls.
+func (b *Breaker) close() {
+	b.state = Closed
+	b.buckets = [bucketsPerWindow]bucket{}
+	b.generation++
+}
+
+// bucket returns the bucket for the time, resetting it if it belongs to a past window.
+func (b *Breaker) bucket(now time.Time) *bucket {
+	width := b.config.Window / bucketsPerWindow
+	if width <= 0 {
+		width = 1
+	}
+
+	start := now.Truncate(width)
+	current := &b.buckets[(now.UnixNano()/int64(width))%bucketsPerWindow]
+
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+
+	return current
+}
+
+// counts returns the number of all and failed calls within the window.
+func (b *Breaker) counts(now time.Time) (int, int) {
+	var total, failures int
+
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.config.Window {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+
+	return total, failures
+}
@@ -0,0 +1,257 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testCooldown = 20 * time.Millisecond
+
+// newTestBreaker creates a breaker opening after half of at least 4 calls fail, with a short cooldown.
+func newTestBreaker(halfOpenRequests int) *Breaker {
+	return New("test", Config{
+		FailureRatio:     0.5,
+		Window:           time.Minute,
+		MinRequests:      4,
+		Cooldown:         testCooldown,
+		HalfOpenRequests: halfOpenRequests,
+	})
+}
+
+// call runs a call through the breaker with the result, it reports whether the call was allowed.
+func call(t *testing.T, b *Breaker, failed bool) bool {
+	t.Helper()
+
+	ticket, err := b.Allow()
+	if err != nil {
+		if !errors.Is(err, ErrOpen) {
+			t.Fatalf("Allow() error = %v, want %v", err, ErrOpen)
+		}
+
+		return false
+	}
+
+	b.Record(ticket, failed)
+
+	return true
+}
+
+// trip opens the breaker.
+func trip(t *testing.T, b *Breaker) {
+	t.Helper()
+
+	for i := 0; i < 4; i++ {
+		call(t, b, true)
+	}
+
+	if b.State() != Open {
+		t.Fatalf("State() = %s after the failures, want %s", b.State(), Open)
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	b := New("test", Config{})
+
+	want := Config{
+		FailureRatio:     defaultFailureRatio,
+		Window:           defaultWindow,
+		MinRequests:      1,
+		Cooldown:         defaultCooldown,
+		HalfOpenRequests: 1,
+	}
+
+	if b.config != want {
+		t.Errorf("config = %+v, want %+v", b.config, want)
+	}
+}
+
+func TestClosedState(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []bool
+		want    State
+	}{
+		{name: "successes keep it closed", results: []bool{false, false, false, false, false}, want: Closed},
+		{name: "failures below the minimum requests", results: []bool{true, true, true}, want: Closed},
+		{name: "failure ratio below the threshold", results: []bool{true, false, false, false, false}, want: Closed},
+		{name: "failure ratio at the threshold", results: []bool{false, false, true, true}, want: Open},
+		{name: "all failed", results: []bool{true, true, true, true}, want: Open},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBreaker(1)
+
+			for _, failed := range tt.results {
+				call(t, b, failed)
+			}
+
+			if got := b.State(); got != tt.want {
+				t.Errorf("State() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	b := newTestBreaker(1)
+	trip(t, b)
+
+	_, err := b.Allow()
+
+	var openErr *OpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("Allow() error = %v, want an *OpenError", err)
+	}
+
+	if openErr.Name != "test" || openErr.RetryAfter <= 0 || openErr.RetryAfter > testCooldown {
+		t.Errorf("OpenError = %+v, want the name and a retry within the cooldown", openErr)
+	}
+}
+
+func TestHalfOpenTransitions(t *testing.T) {
+	tests := []struct {
+		name             string
+		halfOpenRequests int
+		trials           []bool
+		want             State
+	}{
+		{name: "single successful trial closes", halfOpenRequests: 1, trials: []bool{false}, want: Closed},
+		{name: "single failed trial reopens", halfOpenRequests: 1, trials: []bool{true}, want: Open},
+		{name: "one of two successful trials stays half-open", halfOpenRequests: 2, trials: []bool{false},
+			want: HalfOpen},
+		{name: "all the trials successful closes", halfOpenRequests: 3, trials: []bool{false, false, false},
+			want: Closed},
+		{name: "last trial failed reopens", halfOpenRequests: 3, trials: []bool{false, false, true}, want: Open},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBreaker(tt.halfOpenRequests)
+			trip(t, b)
+			time.Sleep(testCooldown)
+
+			if got := b.State(); got != HalfOpen {
+				t.Fatalf("State() after the cooldown = %s, want %s", got, HalfOpen)
+			}
+
+			for i, failed := range tt.trials {
+				if !call(t, b, failed) {
+					t.Fatalf("trial %d rejected", i)
+				}
+			}
+
+			if got := b.State(); got != tt.want {
+				t.Errorf("State() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHalfOpenLimitsTheTrials(t *testing.T) {
+	b := newTestBreaker(2)
+	trip(t, b)
+	time.Sleep(testCooldown)
+
+	first, err := b.Allow()
+	if err != nil {
+		t.Fatalf("first trial: %v", err)
+	}
+
+	second, err := b.Allow()
+	if err != nil {
+		t.Fatalf("second trial: %v", err)
+	}
+
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("third call error = %v, want %v", err, ErrOpen)
+	}
+
+	// The trials count once admitted, a finished trial doesn't make room for another one.
+	b.Record(first, false)
+
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("call after one finished trial error = %v, want %v", err, ErrOpen)
+	}
+
+	b.Record(second, false)
+
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %s, want %s", got, Closed)
+	}
+}
+
+func TestStaleResultsAreIgnored(t *testing.T) {
+	t.Run("success of a call allowed before the circuit opened", func(t *testing.T) {
+		b := newTestBreaker(1)
+
+		stale, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+
+		trip(t, b)
+		time.Sleep(testCooldown)
+
+		trial, err := b.Allow()
+		if err != nil {
+			t.Fatalf("trial: %v", err)
+		}
+
+		b.Record(stale, false)
+
+		if got := b.State(); got != HalfOpen {
+			t.Fatalf("State() after the stale success = %s, want %s", got, HalfOpen)
+		}
+
+		b.Record(trial, true)
+
+		if got := b.State(); got != Open {
+			t.Errorf("State() after the failed trial = %s, want %s", got, Open)
+		}
+	})
+
+	t.Run("failure of a trial after the circuit closed", func(t *testing.T) {
+		b := newTestBreaker(1)
+		trip(t, b)
+		time.Sleep(testCooldown)
+
+		trial, err := b.Allow()
+		if err != nil {
+			t.Fatalf("trial: %v", err)
+		}
+
+		b.Record(trial, false)
+		b.Record(trial, true)
+
+		if got := b.State(); got != Closed {
+			t.Errorf("State() = %s, want %s", got, Closed)
+		}
+	})
+}
+
+func TestClosingForgetsThePastFailures(t *testing.T) {
+	b := newTestBreaker(1)
+	trip(t, b)
+	time.Sleep(testCooldown)
+	call(t, b, false)
+
+	for i := 0; i < 3; i++ {
+		call(t, b, true)
+	}
+
+	if got := b.State(); got != Closed {
+		t.Errorf("State() = %s, want %s below the minimum requests since closing", got, Closed)
+	}
+}
+
+func TestStateString(t *testing.T) {
+	tests := map[State]string{Closed: "closed", Open: "open", HalfOpen: "half-open", State(7): "unknown"}
+
+	for state, want := range tests {
+		if got := state.String(); got != want {
+			t.Errorf("State(%d).String() = %q, want %q", int(state), got, want)
+		}
+	}
+}
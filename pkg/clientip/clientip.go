@@ -0,0 +1,136 @@
+// Package clientip resolves the IP address of the client of a request sent through trusted proxies.
+package clientip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedHeader lists the addresses of the client and the proxies the request passed through.
+const forwardedHeader = "X-Forwarded-For"
+
+var errInvalidNetwork = errors.New("invalid IP address or CIDR")
+
+// Resolver returns the IP address of the client of a request. The X-Forwarded-For header is read from the right,
+// skipping the addresses of the trusted proxies, so an address the client made up is never picked over the one
+// appended by the first trusted proxy.
+type Resolver struct {
+	// The networks of the trusted proxies.
+	trusted []*net.IPNet
+}
+
+// NewResolver creates a new instance of the Resolver trusting the proxies of the IP addresses and CIDRs.
+// The X-Forwarded-For header is ignored if there is no trusted proxy.
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	trusted, err := ParseNetworks(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the trusted proxies: %w", err)
+	}
+
+	return &Resolver{trusted: trusted}, nil
+}
+
+// IP returns the IP address of the client of the request: the peer address if it isn't a trusted proxy,
+// otherwise the rightmost X-Forwarded-For address which isn't one.
+func (r *Resolver) IP(req *http.Request) string {
+	ip := remoteIP(req)
+
+	if r == nil || !r.trustedIP(ip) {
+		return ip
+	}
+
+	hops := forwardedHops(req.Header.Values(forwardedHeader))
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+
+		ip = hops[i]
+
+		if !r.trustedIP(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// trustedIP reports whether the address belongs to a trusted proxy.
+func (r *Resolver) trustedIP(value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+
+	return Contains(r.trusted, ip)
+}
+
+// Contains reports whether the IP address belongs to one of the networks.
+func Contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseNetworks parses the IP addresses and CIDRs, a single address becomes a network of its own.
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %q", errInvalidNetwork, value)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", errInvalidNetwork, value)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// remoteIP returns the IP address of the peer of the request.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// forwardedHops returns the addresses of the X-Forwarded-For header values from the left to the right.
+func forwardedHops(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	return hops
+}
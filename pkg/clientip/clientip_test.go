@@ -0,0 +1,174 @@
+package clientip
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "no trusted proxy ignores the header",
+			remoteAddr: "203.0.113.7:4321",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer ignores the header",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "203.0.113.7:4321",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted peer forwards the client",
+			trusted:    []string{"10.0.0.1"},
+			remoteAddr: "10.0.0.1:4321",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "address made up by the client is skipped",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4321",
+			forwarded:  []string{"1.2.3.4, 198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "chain of trusted proxies",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4321",
+			forwarded:  []string{"1.2.3.4", "198.51.100.1, 10.0.0.3", "10.0.0.2"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "all the hops trusted",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4321",
+			forwarded:  []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "invalid hop stops the walk",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4321",
+			forwarded:  []string{"198.51.100.1, unknown, 10.0.0.2"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "trusted peer without the header",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4321",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "IPv6 peer",
+			trusted:    []string{"::1"},
+			remoteAddr: "[::1]:4321",
+			forwarded:  []string{"2001:db8::1"},
+			want:       "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := NewResolver(tt.trusted)
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+
+			for _, value := range tt.forwarded {
+				req.Header.Add(forwardedHeader, value)
+			}
+
+			if got := resolver.IP(req); got != tt.want {
+				t.Errorf("IP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilResolver(t *testing.T) {
+	var resolver *Resolver
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	req.Header.Set(forwardedHeader, "198.51.100.1")
+
+	if got := resolver.IP(req); got != "203.0.113.7" {
+		t.Errorf("IP() = %s, want the peer address", got)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		contains []string
+		excludes []string
+		wantErr  bool
+	}{
+		{
+			name:     "single IPv4 address",
+			values:   []string{"10.0.0.1"},
+			contains: []string{"10.0.0.1"},
+			excludes: []string{"10.0.0.2"},
+		},
+		{
+			name:     "single IPv6 address",
+			values:   []string{"2001:db8::1"},
+			contains: []string{"2001:db8::1"},
+			excludes: []string{"2001:db8::2"},
+		},
+		{
+			name:     "CIDRs",
+			values:   []string{"10.0.0.0/8", "2001:db8::/32"},
+			contains: []string{"10.255.0.1", "2001:db8::ff"},
+			excludes: []string{"11.0.0.1", "2001:db9::1"},
+		},
+		{name: "empty", values: nil},
+		{name: "host name", values: []string{"proxy"}, wantErr: true},
+		{name: "invalid CIDR", values: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := ParseNetworks(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNetworks() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if err != nil {
+				if !errors.Is(err, errInvalidNetwork) {
+					t.Errorf("ParseNetworks() error = %v, want %v", err, errInvalidNetwork)
+				}
+
+				return
+			}
+
+			for _, ip := range tt.contains {
+				if !Contains(networks, net.ParseIP(ip)) {
+					t.Errorf("the networks don't contain %s", ip)
+				}
+			}
+
+			for _, ip := range tt.excludes {
+				if Contains(networks, net.ParseIP(ip)) {
+					t.Errorf("the networks contain %s", ip)
+				}
+			}
+		})
+	}
+}
@@ -3,57 +3,62 @@ package authclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/UArt-project/UArt-proxy/domain/authdomain"
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
 )
 
+var errNoRedirect = errors.New("the auth response has no redirect location")
+
 type AuthClient interface {
 	// SendAuthRequest sends an auth request.
-	SendAuthRequest() (string, error)
+	SendAuthRequest(ctx context.Context) (string, error)
 	// SendOAuthData sends the OAuth data.
-	SendOAuthData(callbackData authdomain.CallbackRequest) (*authdomain.AuthReturn, error)
+	SendOAuthData(ctx context.Context, callbackData authdomain.CallbackRequest) (*authdomain.AuthReturn, error)
 }
 
 // AuthServiceClient is a client for the auth service.
 type AuthServiceClient struct {
-	// The url of the auth service.
-	url string
-	// The timeout for the requests.
-	timeout time.Duration
+	// The auth service upstream.
+	upstream *upstream.Upstream
+	// The timeout for the requests in nanoseconds, replaced with SetTimeout.
+	timeout *atomic.Int64
 }
 
 // NewAuthServiceClient creates a new instance of the AuthServiceClient.
-func NewAuthServiceClient(url string, timeout time.Duration) *AuthServiceClient {
-	return &AuthServiceClient{
-		url:     url,
-		timeout: timeout,
+func NewAuthServiceClient(authUpstream *upstream.Upstream, timeout time.Duration) *AuthServiceClient {
+	client := &AuthServiceClient{
+		upstream: authUpstream,
+		timeout:  new(atomic.Int64),
 	}
+
+	client.SetTimeout(timeout)
+
+	return client
+}
+
+// SetTimeout sets the timeout of the requests.
+func (c *AuthServiceClient) SetTimeout(timeout time.Duration) {
+	c.timeout.Store(int64(timeout))
 }
 
 // SendAuthRequest sends an auth request.
-func (c AuthServiceClient) SendAuthRequest() (string, error) {
+func (c AuthServiceClient) SendAuthRequest(ctx context.Context) (string, error) {
 	// send auth request to the /auth endpoint and receive a 304 redirect to the auth service
-	httpClient := http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.timeout.Load()))
 
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/oauth2/authorization/google", nil)
-	if err != nil {
-		return "", fmt.Errorf("creating request for sending an auth request: %w", err)
-	}
-
-	resp, err := httpClient.Do(req)
+	resp, err := c.upstream.Do(ctx, http.MethodGet, "/oauth2/authorization/google", nil)
 	if err != nil {
 		return "", fmt.Errorf("sending an auth request: %w", err)
 	}
@@ -61,50 +66,61 @@ func (c AuthServiceClient) SendAuthRequest() (string, error) {
 	// get the redirect url
 	redirectURL := resp.Header.Get("Location")
 
+	_, _ = io.Copy(io.Discard, resp.Body)
+
 	err = resp.Body.Close()
 	if err != nil {
 		return "", fmt.Errorf("closing the response body: %w", err)
 	}
 
+	err = upstream.StatusError(resp)
+	if err != nil {
+		return "", fmt.Errorf("sending an auth request: %w", err)
+	}
+
+	if redirectURL == "" {
+		return "", errdomain.New(errdomain.ErrMalformedPayload, errNoRedirect)
+	}
+
 	return redirectURL, nil
 }
 
 // SendOAuthData sends the OAuth data.
-func (c AuthServiceClient) SendOAuthData(callbackData authdomain.CallbackRequest) (*authdomain.AuthReturn, error) {
+func (c AuthServiceClient) SendOAuthData(ctx context.Context,
+	callbackData authdomain.CallbackRequest,
+) (*authdomain.AuthReturn, error) {
 	// send the OAuth data to the /auth/redirect endpoint and receive a 304 redirect to the proxy
-	httpClient := http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-
-	// getURL := fmt.Sprintf("%s%s?=%s", c.url, "/login/oauth2/code/google", url.QueryEscape(callbackData.State))
-	getURL, err := url.Parse(c.url + "/login/oauth2/code/google")
+	// both requests go to the same target, since the session lives on the instance that handled the callback
+	target, err := c.upstream.Next()
 	if err != nil {
-		return nil, fmt.Errorf("parsing the url: %w", err)
+		return nil, fmt.Errorf("selecting the auth service target: %w", err)
 	}
 
-	query := getURL.Query()
+	query := url.Values{}
 	query.Add("state", callbackData.State)
 	query.Add("code", callbackData.Code)
 	query.Add("scope", callbackData.Scope)
 	query.Add("authuser", callbackData.AuthUser)
 	query.Add("prompt", callbackData.Prompt)
 
-	getURL.RawQuery = query.Encode()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.timeout.Load()))
 
-	fmt.Println(getURL.String())
+	defer cancel()
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	respCode, err := c.upstream.DoTarget(ctx, target, http.MethodGet,
+		"/login/oauth2/code/google?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("sending the OAuth data: %w", err)
+	}
 
-	defer cancel()
+	_, _ = io.Copy(io.Discard, respCode.Body)
 
-	reqCode, err := http.NewRequestWithContext(ctx, http.MethodGet, getURL.String(), nil)
+	err = respCode.Body.Close()
 	if err != nil {
-		return nil, fmt.Errorf("creating request for sending the OAuth data: %w", err)
+		return nil, fmt.Errorf("closing the response body: %w", err)
 	}
 
-	respCode, err := httpClient.Do(reqCode)
+	err = upstream.StatusError(respCode)
 	if err != nil {
 		return nil, fmt.Errorf("sending the OAuth data: %w", err)
 	}
@@ -119,21 +135,24 @@ func (c AuthServiceClient) SendOAuthData(callbackData authdomain.CallbackRequest
 	sessionCookie = strings.TrimRight(sessionCookie, "; Path=/; HttpOnly")
 
 	// send get /id with the session cookie
-	reqID, err := http.NewRequest("GET", c.url+"/id", nil)
+	headerID := http.Header{}
+	headerID.Set("Cookie", sessionCookie)
+
+	respID, err := c.upstream.DoTarget(ctx, target, http.MethodGet, "/id", headerID)
 	if err != nil {
-		return nil, fmt.Errorf("creating request for sending the OAuth data: %w", err)
+		return nil, fmt.Errorf("sending the OAuth data: %w", err)
 	}
 
-	// reqID.AddCookie(sessionCookie)
-	// if callbackData.Cookie != "" {
-	// reqID.AddCookie(&http.Cookie{Value: callbackData.Cookie})
-	// } else {
-	reqID.Header.Set("Cookie", sessionCookie)
-	// }
+	_, _ = io.Copy(io.Discard, respID.Body)
 
-	respID, err := httpClient.Do(reqID)
+	err = respID.Body.Close()
 	if err != nil {
-		return nil, fmt.Errorf("sending the OAuth data: %w", err)
+		return nil, fmt.Errorf("closing the response body: %w", err)
+	}
+
+	err = upstream.StatusError(respID)
+	if err != nil {
+		return nil, fmt.Errorf("getting the auth token: %w", err)
 	}
 
 	// fmt.Println("Request: ", reqID)
@@ -0,0 +1,59 @@
+package authclient
+
+import (
+	"context"
+
+	"github.com/UArt-project/UArt-proxy/domain/authdomain"
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/circuitbreaker"
+)
+
+// BreakerClient is an AuthClient failing fast while the auth service is down.
+type BreakerClient struct {
+	// The wrapped client.
+	client AuthClient
+	// The circuit breaker.
+	breaker *circuitbreaker.Breaker
+}
+
+// NewBreakerClient wraps the client in the circuit breaker.
+func NewBreakerClient(client AuthClient, breaker *circuitbreaker.Breaker) *BreakerClient {
+	return &BreakerClient{
+		client:  client,
+		breaker: breaker,
+	}
+}
+
+// SendAuthRequest sends an auth request.
+func (c BreakerClient) SendAuthRequest(ctx context.Context) (string, error) {
+	ticket, err := c.breaker.Allow()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	url, err := c.client.SendAuthRequest(ctx)
+	c.breaker.Record(ticket, failed(ctx, err))
+
+	return url, err
+}
+
+// SendOAuthData sends the OAuth data.
+func (c BreakerClient) SendOAuthData(ctx context.Context,
+	callbackData authdomain.CallbackRequest,
+) (*authdomain.AuthReturn, error) {
+	ticket, err := c.breaker.Allow()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	data, err := c.client.SendOAuthData(ctx, callbackData)
+	c.breaker.Record(ticket, failed(ctx, err))
+
+	return data, err
+}
+
+// failed reports whether the error counts as a failure of the service,
+// the rejected requests and the requests cancelled by the caller don't.
+func failed(ctx context.Context, err error) bool {
+	return err != nil && !errdomain.IsClientError(err) && !errdomain.IsCanceled(ctx, err)
+}
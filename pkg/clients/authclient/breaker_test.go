@@ -0,0 +1,58 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/domain/authdomain"
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/circuitbreaker"
+)
+
+// failingClient is an auth client failing every request with the error.
+type failingClient struct {
+	err error
+}
+
+// SendAuthRequest returns the error.
+func (c failingClient) SendAuthRequest(ctx context.Context) (string, error) {
+	return "", c.err
+}
+
+// SendOAuthData returns the error.
+func (c failingClient) SendOAuthData(ctx context.Context,
+	callbackData authdomain.CallbackRequest,
+) (*authdomain.AuthReturn, error) {
+	return nil, c.err
+}
+
+func TestBreakerClientIgnoresCancelledRequests(t *testing.T) {
+	breaker := circuitbreaker.New("auth", circuitbreaker.Config{
+		FailureRatio: 0.5,
+		Window:       time.Minute,
+		MinRequests:  2,
+		Cooldown:     time.Minute,
+	})
+	client := NewBreakerClient(failingClient{err: errdomain.New(errdomain.ErrUpstreamUnavailable,
+		fmt.Errorf("sending request to auth: %w", context.Canceled))}, breaker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.SendAuthRequest(ctx); errors.Is(err, circuitbreaker.ErrOpen) {
+			t.Fatalf("SendAuthRequest() error = %v after %d cancelled requests", err, i)
+		}
+
+		if _, err := client.SendOAuthData(ctx, authdomain.CallbackRequest{}); errors.Is(err, circuitbreaker.ErrOpen) {
+			t.Fatalf("SendOAuthData() error = %v after %d cancelled requests", err, i)
+		}
+	}
+
+	if got := breaker.State(); got != circuitbreaker.Closed {
+		t.Errorf("State() = %s, want %s", got, circuitbreaker.Closed)
+	}
+}
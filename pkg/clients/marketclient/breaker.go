@@ -0,0 +1,44 @@
+package marketclient
+
+import (
+	"context"
+
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
+	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/circuitbreaker"
+)
+
+// BreakerClient is a MarketClient failing fast while the market service is down.
+type BreakerClient struct {
+	// The wrapped client.
+	client MarketClient
+	// The circuit breaker.
+	breaker *circuitbreaker.Breaker
+}
+
+// NewBreakerClient wraps the client in the circuit breaker.
+func NewBreakerClient(client MarketClient, breaker *circuitbreaker.Breaker) *BreakerClient {
+	return &BreakerClient{
+		client:  client,
+		breaker: breaker,
+	}
+}
+
+// GetPage returns a page of market items.
+func (c BreakerClient) GetPage(ctx context.Context, page int) ([]marketdomain.MarketItem, error) {
+	ticket, err := c.breaker.Allow()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	items, err := c.client.GetPage(ctx, page)
+	c.breaker.Record(ticket, failed(ctx, err))
+
+	return items, err
+}
+
+// failed reports whether the error counts as a failure of the service,
+// the rejected requests and the requests cancelled by the caller don't.
+func failed(ctx context.Context, err error) bool {
+	return err != nil && !errdomain.IsClientError(err) && !errdomain.IsCanceled(ctx, err)
+}
@@ -0,0 +1,92 @@
+package marketclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
+	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/circuitbreaker"
+)
+
+// failingClient is a market client failing every request with the error.
+type failingClient struct {
+	err error
+}
+
+// GetPage returns the error.
+func (c failingClient) GetPage(ctx context.Context, page int) ([]marketdomain.MarketItem, error) {
+	return nil, c.err
+}
+
+func TestBreakerClientFailures(t *testing.T) {
+	canceled := errdomain.New(errdomain.ErrUpstreamUnavailable,
+		fmt.Errorf("sending request to market: %w", context.Canceled))
+
+	tests := []struct {
+		name      string
+		err       error
+		cancel    bool
+		wantState circuitbreaker.State
+	}{
+		{
+			name:      "upstream failures open the breaker",
+			err:       errdomain.New(errdomain.ErrUpstreamUnavailable, errors.New("connection refused")),
+			wantState: circuitbreaker.Open,
+		},
+		{
+			name:      "timeouts open the breaker",
+			err:       errdomain.New(errdomain.ErrTimeout, context.DeadlineExceeded),
+			wantState: circuitbreaker.Open,
+		},
+		{
+			name:      "rejected requests keep it closed",
+			err:       errdomain.New(errdomain.ErrNotFound, errors.New("no such page")),
+			wantState: circuitbreaker.Closed,
+		},
+		{
+			name:      "requests cancelled by the caller keep it closed",
+			err:       canceled,
+			cancel:    true,
+			wantState: circuitbreaker.Closed,
+		},
+		{
+			name:      "failure reported after the caller left keeps it closed",
+			err:       errdomain.New(errdomain.ErrUpstreamUnavailable, errors.New("status 503")),
+			cancel:    true,
+			wantState: circuitbreaker.Closed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := circuitbreaker.New("market", circuitbreaker.Config{
+				FailureRatio: 0.5,
+				Window:       time.Minute,
+				MinRequests:  2,
+				Cooldown:     time.Minute,
+			})
+			client := NewBreakerClient(failingClient{err: tt.err}, breaker)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			} else {
+				defer cancel()
+			}
+
+			for i := 0; i < 3; i++ {
+				if _, err := client.GetPage(ctx, 1); errors.Is(err, circuitbreaker.ErrOpen) {
+					break
+				}
+			}
+
+			if got := breaker.State(); got != tt.wantState {
+				t.Errorf("State() = %s, want %s", got, tt.wantState)
+			}
+		})
+	}
+}
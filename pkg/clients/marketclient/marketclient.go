@@ -7,47 +7,52 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
 	"github.com/UArt-project/UArt-proxy/domain/marketdomain"
 	"github.com/UArt-project/UArt-proxy/pkg/jsonoperations"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
 )
 
 type MarketClient interface {
 	// GetPage returns a page of market items.
-	GetPage(page int) ([]marketdomain.MarketItem, error)
+	GetPage(ctx context.Context, page int) ([]marketdomain.MarketItem, error)
 }
 
 // MarketServiceClient is a client for the market service.
 type MarketServiceClient struct {
-	// The url of the market service.
-	url string
-	// Timeout for the request.
-	timeout time.Duration
+	// The market service upstream.
+	upstream *upstream.Upstream
+	// Timeout for the request in nanoseconds, replaced with SetTimeout.
+	timeout *atomic.Int64
 }
 
 // NewMarketServiceClient creates a new instance of the MarketServiceClient.
-func NewMarketServiceClient(url string, timeout time.Duration) *MarketServiceClient {
-	return &MarketServiceClient{
-		url:     url,
-		timeout: timeout,
+func NewMarketServiceClient(marketUpstream *upstream.Upstream, timeout time.Duration) *MarketServiceClient {
+	client := &MarketServiceClient{
+		upstream: marketUpstream,
+		timeout:  new(atomic.Int64),
 	}
+
+	client.SetTimeout(timeout)
+
+	return client
 }
 
-// GetPage returns a page of market items.
-func (c MarketServiceClient) GetPage(page int) ([]marketdomain.MarketItem, error) {
-	var httpClient http.Client
+// SetTimeout sets the timeout of the requests.
+func (c *MarketServiceClient) SetTimeout(timeout time.Duration) {
+	c.timeout.Store(int64(timeout))
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+// GetPage returns a page of market items.
+func (c MarketServiceClient) GetPage(ctx context.Context, page int) ([]marketdomain.MarketItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.timeout.Load()))
 
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/marketplace/v1/items/"+strconv.Itoa(page), nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating request for getting the page of items: %w", err)
-	}
-
-	resp, err := httpClient.Do(req)
+	resp, err := c.upstream.Do(ctx, http.MethodGet, "/marketplace/v1/items/"+strconv.Itoa(page), nil)
 	if err != nil {
 		return nil, fmt.Errorf("getting the page of items: %w", err)
 	}
@@ -56,7 +61,7 @@ func (c MarketServiceClient) GetPage(page int) ([]marketdomain.MarketItem, error
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("reading the response body: %w", err)
+		return nil, errdomain.New(errdomain.ErrUpstreamUnavailable, fmt.Errorf("reading the response body: %w", err))
 	}
 
 	err = resp.Body.Close()
@@ -64,9 +69,14 @@ func (c MarketServiceClient) GetPage(page int) ([]marketdomain.MarketItem, error
 		return nil, fmt.Errorf("closing the response body: %w", err)
 	}
 
+	err = upstream.StatusError(resp)
+	if err != nil {
+		return nil, fmt.Errorf("checking the response status: %w", err)
+	}
+
 	err = jsonoperations.Decode(body, &items)
 	if err != nil {
-		return nil, fmt.Errorf("decoding the response body: %w", err)
+		return nil, errdomain.New(errdomain.ErrMalformedPayload, fmt.Errorf("decoding the response body: %w", err))
 	}
 
 	banderaSmoothiePrice := 100.0
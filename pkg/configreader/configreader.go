@@ -1,19 +1,424 @@
 // Package configreader is responsible for getting needed configs.
+//
+// The values are layered, a later layer overriding the keys of the earlier ones:
+//  1. the config file, config.yaml by default;
+//  2. the profile file next to it, config.<profile>.yaml, if a profile is selected;
+//  3. the environment variables named after the keys with the EnvPrefix, the dots replaced
+//     with underscores, e.g. UART_PROXY_MARKET_TIMEOUT for market.timeout.
+//
+// The environment values of list keys are split on commas. Only the variables naming a key of the files
+// or of the Schema, or an entry of a Schema map, are applied, the others are reported by IgnoredEnv.
 package configreader
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
+// EnvPrefix is the prefix of the environment variables overriding the config keys.
+const EnvPrefix = "UART_PROXY_"
+
+// Environment variables selecting the config files, they aren't config keys.
+const (
+	EnvConfig  = EnvPrefix + "CONFIG"
+	EnvProfile = EnvPrefix + "PROFILE"
+)
+
+var errNoConfigFile = errors.New("no config file is set")
+
+// Options select the config files.
+type Options struct {
+	// Path of the config file.
+	Path string
+	// Profile merged over the config file from the config.<profile>.yaml file next to it, none if empty.
+	Profile string
+	// Schema of the keys the environment may set besides the keys of the files.
+	Schema Schema
+}
+
+// files returns the paths of the config files in the order of precedence.
+func (o Options) files() []string {
+	if o.Profile == "" {
+		return []string{o.Path}
+	}
+
+	return []string{o.Path, ProfilePath(o.Path, o.Profile)}
+}
+
+// ProfilePath returns the path of the profile file of the config file, config.prod.yaml for config.yaml.
+func ProfilePath(path, profile string) string {
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// Config is a loaded config file.
+type Config struct {
+	// The values of the files and the environment.
+	values *viper.Viper
+	// The options the config was loaded with.
+	options Options
+	// The latest modification time of the files when they were read.
+	modTime time.Time
+	// The names of the environment variables with the EnvPrefix matching no key.
+	ignoredEnv []string
+}
+
+// current is the config swapped in by the last successful load, nil until SetConfigFile succeeds.
+var current atomic.Pointer[Config] //nolint:gochecknoglobals
+
+// seenModTime is the modification time of the last file read, including the rejected ones,
+// so a rejected file isn't reloaded again until it changes.
+var seenModTime atomic.Int64 //nolint:gochecknoglobals
+
+// reloadResult is the outcome of a reload.
+type reloadResult struct {
+	// The error the reload failed with, nil if it succeeded.
+	err error
+}
+
+// lastReload is the outcome of the last reload, nil until the first one.
+var lastReload atomic.Pointer[reloadResult] //nolint:gochecknoglobals
+
+// reloadMu serializes the reloads.
+var reloadMu sync.Mutex //nolint:gochecknoglobals
+
 // SetConfigFile defines path and name of the desired config file.
 func SetConfigFile(path string) error {
-	viper.SetConfigFile(path)
+	return Load(Options{Path: path})
+}
+
+// Load reads the config files selected by the options and the environment overrides.
+func Load(options Options) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	cfg, err := load(options)
+	if err != nil {
+		return err
+	}
+
+	current.Store(cfg)
+	seenModTime.Store(cfg.modTime.UnixNano())
+	lastReload.Store(nil)
+
+	return nil
+}
+
+// LastReloadError returns the error the last reload failed with, nil if it succeeded or none ran since Load.
+// The config in use is then older than the file.
+func LastReloadError() error {
+	if result := lastReload.Load(); result != nil {
+		return result.err
+	}
+
+	return nil
+}
+
+// Current returns the config in use.
+func Current() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+
+	return &Config{values: viper.New()}
+}
+
+// Reload reads the config files declared in Load again and swaps it in if validate accepts it.
+// The config in use is kept if the file can't be read or validate fails.
+func Reload(validate func(candidate *Config) error) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	err := reload(validate)
+	lastReload.Store(&reloadResult{err: err})
+
+	return err
+}
+
+// reload reads the config files again and swaps it in if validate accepts it, the caller must hold reloadMu.
+func reload(validate func(candidate *Config) error) error {
+	cfg := current.Load()
+	if cfg == nil {
+		return errNoConfigFile
+	}
+
+	candidate, err := load(cfg.options)
+	if err != nil {
+		return err
+	}
+
+	seenModTime.Store(candidate.modTime.UnixNano())
+
+	if err := validate(candidate); err != nil {
+		return fmt.Errorf("config validation: %w", err)
+	}
+
+	current.Store(candidate)
+
+	return nil
+}
+
+// Watch checks the config file for changes on every interval and calls onChange when it changes.
+// It returns the function stopping the watch.
+func Watch(interval time.Duration, onChange func()) (stop func()) {
+	stopChan := make(chan struct{})
+	wg := new(sync.WaitGroup)
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+				if changed() {
+					onChange()
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stopChan)
+
+		wg.Wait()
+	}
+}
+
+// changed reports whether the config files were modified since they were last read.
+func changed() bool {
+	cfg := current.Load()
+	if cfg == nil {
+		return false
+	}
+
+	modTime, err := latestModTime(cfg.options.files())
+	if err != nil {
+		return false
+	}
+
+	return modTime.UnixNano() != seenModTime.Load()
+}
+
+// load reads the config files selected by the options and applies the environment overrides.
+func load(options Options) (*Config, error) {
+	files := options.files()
+
+	modTime, err := latestModTime(files)
+	if err != nil {
+		return nil, err
+	}
+
+	fileValues := viper.New()
+
+	for i, file := range files {
+		fileValues.SetConfigFile(file)
+
+		if i == 0 {
+			err = fileValues.ReadInConfig()
+		} else {
+			err = fileValues.MergeInConfig()
+		}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return fmt.Errorf("config read: %w", err)
+		if err != nil {
+			return nil, fmt.Errorf("config read %s: %w", file, err)
+		}
+	}
+
+	schema := Schema{
+		Keys: append(fileValues.AllKeys(), options.Schema.Keys...),
+		Maps: options.Schema.Maps,
+	}
+
+	settings := fileValues.AllSettings()
+	ignoredEnv := applyEnv(settings, schema, os.Environ())
+
+	values := viper.New()
+
+	if err := values.MergeConfigMap(settings); err != nil {
+		return nil, fmt.Errorf("config merge: %w", err)
+	}
+
+	return &Config{
+		values:     values,
+		options:    options,
+		modTime:    modTime,
+		ignoredEnv: ignoredEnv,
+	}, nil
+}
+
+// latestModTime returns the latest modification time of the files.
+func latestModTime(files []string) (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("config read: %w", err)
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// applyEnv overrides the settings with the environment variables having the EnvPrefix and returns
+// the names of the ignored ones. The variables are matched against the keys of the schema, so the keys
+// with underscores can be overridden, then against the entries of its maps, e.g. UART_PROXY_ADMIN_TOKENS_OPS
+// sets the "ops" key of admin.tokens. The variables matching neither, like the ones Kubernetes defines
+// for a service named uart-proxy, are ignored.
+func applyEnv(settings map[string]any, schema Schema, environ []string) []string {
+	knownKeys := make(map[string]string, len(schema.Keys))
+	for _, key := range schema.Keys {
+		knownKeys[strings.ReplaceAll(key, ".", "_")] = key
+	}
+
+	var ignored []string
+
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(name, EnvPrefix) || name == EnvConfig || name == EnvProfile {
+			continue
+		}
+
+		envKey := strings.ToLower(strings.TrimPrefix(name, EnvPrefix))
+
+		path, ok := envPath(envKey, knownKeys, schema.Maps)
+		if !ok {
+			ignored = append(ignored, name)
+
+			continue
+		}
+
+		setNested(settings, path, value)
+	}
+
+	sort.Strings(ignored)
+
+	return ignored
+}
+
+// envPath returns the path of the setting overridden by the lowercased environment key.
+func envPath(envKey string, knownKeys map[string]string, maps []string) ([]string, bool) {
+	if key, ok := knownKeys[envKey]; ok {
+		return strings.Split(key, "."), true
+	}
+
+	for _, mapKey := range maps {
+		prefix := strings.ReplaceAll(mapKey, ".", "_") + "_"
+
+		if strings.HasPrefix(envKey, prefix) && len(envKey) > len(prefix) {
+			return append(strings.Split(mapKey, "."), strings.TrimPrefix(envKey, prefix)), true
+		}
+	}
+
+	return nil, false
+}
+
+// setNested sets the value at the path of the nested settings, creating the missing maps.
+// The value of a list is split on commas.
+func setNested(settings map[string]any, path []string, value string) {
+	for _, part := range path[:len(path)-1] {
+		next, ok := settings[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			settings[part] = next
+		}
+
+		settings = next
+	}
+
+	last := path[len(path)-1]
+
+	if _, ok := settings[last].([]any); ok {
+		items := strings.Split(value, ",")
+		list := make([]any, 0, len(items))
+
+		for _, item := range items {
+			list = append(list, strings.TrimSpace(item))
+		}
+
+		settings[last] = list
+
+		return
+	}
+
+	settings[last] = value
+}
+
+// UnmarshalExact decodes the whole config into rawVal, failing on the keys rawVal has no field for.
+func (c *Config) UnmarshalExact(rawVal any) error {
+	if err := c.values.UnmarshalExact(rawVal); err != nil {
+		return fmt.Errorf("config unmarshal: %w", err)
+	}
+
+	return nil
+}
+
+// IgnoredEnv returns the names of the environment variables with the EnvPrefix matching no key.
+func (c *Config) IgnoredEnv() []string {
+	return c.ignoredEnv
+}
+
+// AllSettings returns all the values of the config as nested maps, the keys are lowercased.
+func (c *Config) AllSettings() map[string]any {
+	return c.values.AllSettings()
+}
+
+// GetString reads string with the specified key from the config.
+func (c *Config) GetString(key string) string {
+	return c.values.GetString(key)
+}
+
+// GetStringSlice reads []string with the specified key from the config.
+func (c *Config) GetStringSlice(key string) []string {
+	return c.values.GetStringSlice(key)
+}
+
+// GetDuration reads time.Duration with the specified key from the config.
+func (c *Config) GetDuration(key string) time.Duration {
+	return c.values.GetDuration(key)
+}
+
+// GetInt reads int with the specified key from the config.
+func (c *Config) GetInt(key string) int {
+	return c.values.GetInt(key)
+}
+
+// GetBool reads bool with the specified key from the config.
+func (c *Config) GetBool(key string) bool {
+	return c.values.GetBool(key)
+}
+
+// GetFloat64 reads float64 with the specified key from the config.
+func (c *Config) GetFloat64(key string) float64 {
+	return c.values.GetFloat64(key)
+}
+
+// UnmarshalKey decodes the value with the specified key from the config into rawVal.
+func (c *Config) UnmarshalKey(key string, rawVal any) error {
+	if err := c.values.UnmarshalKey(key, rawVal); err != nil {
+		return fmt.Errorf("config unmarshal %s: %w", key, err)
 	}
 
 	return nil
@@ -21,15 +426,35 @@ func SetConfigFile(path string) error {
 
 // GetString reads string with the specified key from the config file declared in SetConfigFile.
 func GetString(key string) string {
-	return viper.GetString(key)
+	return Current().GetString(key)
+}
+
+// GetStringSlice reads []string with the specified key from the config file declared in SetConfigFile.
+func GetStringSlice(key string) []string {
+	return Current().GetStringSlice(key)
 }
 
 // GetDuration reads time.Duration with the specified key from the config file declared in SetConfigFile.
 func GetDuration(key string) time.Duration {
-	return viper.GetDuration(key)
+	return Current().GetDuration(key)
 }
 
 // GetInt reads int with the specified key from the config file declared in SetConfigFile.
 func GetInt(key string) int {
-	return viper.GetInt(key)
+	return Current().GetInt(key)
+}
+
+// GetBool reads bool with the specified key from the config file declared in SetConfigFile.
+func GetBool(key string) bool {
+	return Current().GetBool(key)
+}
+
+// GetFloat64 reads float64 with the specified key from the config file declared in SetConfigFile.
+func GetFloat64(key string) float64 {
+	return Current().GetFloat64(key)
+}
+
+// UnmarshalKey decodes the value with the specified key from the config file declared in SetConfigFile into rawVal.
+func UnmarshalKey(key string, rawVal any) error {
+	return Current().UnmarshalKey(key, rawVal)
 }
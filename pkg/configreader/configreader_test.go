@@ -0,0 +1,281 @@
+package configreader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const baseConfig = `
+server:
+  port: 8000
+  host: ""
+market:
+  timeout: 5s
+  targets:
+    - http://market:8080
+admin:
+  tokens:
+    ops: fromfile
+`
+
+// writeConfig writes the config file with the content to the directory and returns its path.
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+
+	return path
+}
+
+func TestProfilePath(t *testing.T) {
+	tests := map[string]string{
+		"config.yaml":           "config.prod.yaml",
+		"/etc/uart/config.yaml": "/etc/uart/config.prod.yaml",
+		"config":                "config.prod",
+	}
+
+	for path, want := range tests {
+		if got := ProfilePath(path, "prod"); got != want {
+			t.Errorf("ProfilePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestLayering(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.yaml", baseConfig)
+	writeConfig(t, dir, "config.prod.yaml", "market:\n  timeout: 10s\nserver:\n  host: proxy.internal\n")
+
+	tests := []struct {
+		name    string
+		profile string
+		env     map[string]string
+		want    map[string]any
+	}{
+		{
+			name: "config file",
+			want: map[string]any{"server.port": 8000, "market.timeout": 5 * time.Second, "server.host": ""},
+		},
+		{
+			name:    "profile over the config file",
+			profile: "prod",
+			want: map[string]any{"server.port": 8000, "market.timeout": 10 * time.Second,
+				"server.host": "proxy.internal"},
+		},
+		{
+			name:    "environment over the profile",
+			profile: "prod",
+			env:     map[string]string{"UART_PROXY_MARKET_TIMEOUT": "15s", "UART_PROXY_SERVER_PORT": "9000"},
+			want: map[string]any{"server.port": 9000, "market.timeout": 15 * time.Second,
+				"server.host": "proxy.internal"},
+		},
+		{
+			name: "environment list split on commas",
+			env:  map[string]string{"UART_PROXY_MARKET_TARGETS": "http://a:8080, http://b:8080"},
+			want: map[string]any{"market.targets": []string{"http://a:8080", "http://b:8080"}},
+		},
+		{
+			name: "environment map entries",
+			env:  map[string]string{"UART_PROXY_ADMIN_TOKENS_OPS": "fromenv", "UART_PROXY_ADMIN_TOKENS_CI": "new"},
+			want: map[string]any{"admin.tokens.ops": "fromenv", "admin.tokens.ci": "new"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := load(Options{Path: path, Profile: tt.profile, Schema: Schema{Maps: []string{"admin.tokens"}}})
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+
+			for key, want := range tt.want {
+				var got any
+
+				switch want.(type) {
+				case int:
+					got = cfg.GetInt(key)
+				case time.Duration:
+					got = cfg.GetDuration(key)
+				case []string:
+					got = cfg.GetStringSlice(key)
+				default:
+					got = cfg.GetString(key)
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMissingProfile(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "config.yaml", baseConfig)
+
+	if _, err := load(Options{Path: path, Profile: "staging"}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("load() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	schema := Schema{
+		Keys: []string{"server.port", "market.servicehost", "market.targets"},
+		Maps: []string{"admin.tokens"},
+	}
+
+	tests := []struct {
+		name        string
+		settings    map[string]any
+		environ     []string
+		want        map[string]any
+		wantIgnored []string
+	}{
+		{
+			name:    "known key",
+			environ: []string{"UART_PROXY_SERVER_PORT=9000"},
+			want:    map[string]any{"server": map[string]any{"port": "9000"}},
+		},
+		{
+			name:    "key with an underscore matched as a whole",
+			environ: []string{"UART_PROXY_MARKET_SERVICEHOST=market"},
+			want:    map[string]any{"market": map[string]any{"servicehost": "market"}},
+		},
+		{
+			name:    "map entry",
+			environ: []string{"UART_PROXY_ADMIN_TOKENS_OPS=secret"},
+			want:    map[string]any{"admin": map[string]any{"tokens": map[string]any{"ops": "secret"}}},
+		},
+		{
+			name:     "list",
+			settings: map[string]any{"market": map[string]any{"targets": []any{"x"}}},
+			environ:  []string{"UART_PROXY_MARKET_TARGETS=a,b"},
+			want:     map[string]any{"market": map[string]any{"targets": []any{"a", "b"}}},
+		},
+		{
+			name: "unknown variables ignored",
+			environ: []string{"UART_PROXY_SERVICE_HOST=10.0.0.1", "UART_PROXY_PORT=tcp://10.0.0.1:8000",
+				"UART_PROXY_ADMIN_TOKENS_=empty"},
+			want:        map[string]any{},
+			wantIgnored: []string{"UART_PROXY_ADMIN_TOKENS_", "UART_PROXY_PORT", "UART_PROXY_SERVICE_HOST"},
+		},
+		{
+			name:    "file selection and unprefixed variables skipped",
+			environ: []string{EnvConfig + "=/etc/config.yaml", EnvProfile + "=prod", "HOME=/root"},
+			want:    map[string]any{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := tt.settings
+			if settings == nil {
+				settings = map[string]any{}
+			}
+
+			ignored := applyEnv(settings, schema, tt.environ)
+
+			if !reflect.DeepEqual(settings, tt.want) {
+				t.Errorf("settings = %v, want %v", settings, tt.want)
+			}
+
+			if !reflect.DeepEqual(ignored, tt.wantIgnored) {
+				t.Errorf("ignored = %v, want %v", ignored, tt.wantIgnored)
+			}
+		})
+	}
+}
+
+func TestLoadReportsIgnoredEnv(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "config.yaml", baseConfig)
+	t.Setenv("UART_PROXY_SERVICE_PORT", "tcp://10.0.0.1:8000")
+
+	cfg, err := load(Options{Path: path})
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+
+	if got := cfg.IgnoredEnv(); !reflect.DeepEqual(got, []string{"UART_PROXY_SERVICE_PORT"}) {
+		t.Errorf("IgnoredEnv() = %v, want [UART_PROXY_SERVICE_PORT]", got)
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	type nested struct {
+		Timeout time.Duration `mapstructure:"timeout"`
+	}
+
+	type Common struct {
+		Name string `mapstructure:"name"`
+	}
+
+	type config struct {
+		Common   `mapstructure:",squash"`
+		Market   nested            `mapstructure:"market"`
+		Auth     *nested           `mapstructure:"auth"`
+		Tokens   map[string]string `mapstructure:"adminTokens"`
+		Started  time.Time         `mapstructure:"started"`
+		Targets  []string          `mapstructure:"targets"`
+		Skipped  string            `mapstructure:"-"`
+		Untagged int
+		hidden   int
+	}
+
+	got := SchemaOf(config{hidden: 1})
+	want := Schema{
+		Keys: []string{"name", "market.timeout", "auth.timeout", "started", "targets", "untagged"},
+		Maps: []string{"admintokens"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaOf() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.yaml", baseConfig)
+
+	if err := Load(Options{Path: path}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	writeConfig(t, dir, "config.yaml", "server:\n  port: 9000\n")
+
+	errRejected := errors.New("rejected")
+
+	if err := Reload(func(*Config) error { return errRejected }); !errors.Is(err, errRejected) {
+		t.Fatalf("Reload() error = %v, want %v", err, errRejected)
+	}
+
+	if err := LastReloadError(); !errors.Is(err, errRejected) {
+		t.Errorf("LastReloadError() = %v, want %v", err, errRejected)
+	}
+
+	if got := GetInt("server.port"); got != 8000 {
+		t.Errorf("server.port after the rejected reload = %d, want 8000", got)
+	}
+
+	if err := Reload(func(candidate *Config) error { return nil }); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	if err := LastReloadError(); err != nil {
+		t.Errorf("LastReloadError() after the reload = %v, want nil", err)
+	}
+
+	if got := GetInt("server.port"); got != 9000 {
+		t.Errorf("server.port after the reload = %d, want 9000", got)
+	}
+}
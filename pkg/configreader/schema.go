@@ -0,0 +1,69 @@
+package configreader
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema lists the keys the environment variables may override besides the keys of the config files.
+type Schema struct {
+	// The dotted keys of the values.
+	Keys []string
+	// The dotted keys of the maps taking any key from the environment, e.g. admin.tokens.
+	Maps []string
+}
+
+// SchemaOf returns the schema of the config decoded into v, following its mapstructure tags.
+func SchemaOf(v any) Schema {
+	var schema Schema
+
+	schema.add(reflect.TypeOf(v), "")
+
+	return schema
+}
+
+// add records the keys of the fields of the struct type under the prefix.
+func (s *Schema) add(typ reflect.Type, prefix string) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if options == "squash" {
+			s.add(fieldType, prefix)
+
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		key := prefix + strings.ToLower(name)
+
+		switch {
+		case fieldType.Kind() == reflect.Struct && fieldType != reflect.TypeOf(time.Time{}):
+			s.add(fieldType, key+".")
+		case fieldType.Kind() == reflect.Map:
+			s.Maps = append(s.Maps, key)
+		default:
+			s.Keys = append(s.Keys, key)
+		}
+	}
+}
@@ -3,15 +3,56 @@ package cors
 
 import (
 	"net/http"
+	"strings"
+	"sync/atomic"
 
 	"github.com/gorilla/handlers"
 )
 
-func EnableCORS(api http.Handler) http.Handler {
-	headersOK := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Location", "Authorization"})
-	originsOK := handlers.AllowedOrigins([]string{"*"})
+// AnyOrigin allows the requests of all the origins.
+const AnyOrigin = "*"
+
+// Origins is the list of the allowed origins, it can be replaced while serving.
+type Origins struct {
+	// The allowed origins.
+	origins atomic.Pointer[[]string]
+}
+
+// NewOrigins creates a new instance of the Origins allowing the specified origins.
+func NewOrigins(origins []string) *Origins {
+	allowed := new(Origins)
+	allowed.Set(origins)
+
+	return allowed
+}
+
+// Set replaces the allowed origins, AnyOrigin or an empty list allows all the origins.
+func (o *Origins) Set(origins []string) {
+	if len(origins) == 0 {
+		origins = []string{AnyOrigin}
+	}
+
+	o.origins.Store(&origins)
+}
+
+// Allowed reports whether the requests of the origin are allowed.
+func (o *Origins) Allowed(origin string) bool {
+	for _, allowed := range *o.origins.Load() {
+		if allowed == AnyOrigin || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func EnableCORS(api http.Handler, origins *Origins) http.Handler {
+	headersOK := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Location", "Authorization",
+		"X-Request-ID", "Traceparent", "Tracestate"})
+	originsOK := handlers.AllowedOriginValidator(origins.Allowed)
 	methodsOK := handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT"})
-	exposedHeaders := handlers.ExposedHeaders([]string{"X-Response-Time", "X-Server-Name", "Location"})
+	exposedHeaders := handlers.ExposedHeaders([]string{"X-Response-Time", "X-Server-Name", "Location", "X-Request-ID",
+		"X-Cache"})
 
 	return handlers.CORS(headersOK, originsOK, methodsOK, exposedHeaders)(api)
 }
@@ -0,0 +1,357 @@
+// Package healthcheck provides active and passive health checking of upstream targets.
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
+)
+
+const defaultInterval = 10 * time.Second
+
+var errUnknownUpstream = errors.New("the upstream isn't watched")
+
+// Config consists of the health checking options of an upstream.
+type Config struct {
+	// Path probed on every target, active checking is disabled if empty.
+	Path string `mapstructure:"path"`
+	// Interval between the probes.
+	Interval time.Duration `mapstructure:"interval"`
+	// Timeout of a single probe.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// UnhealthyThreshold is the number of consecutive failed probes ejecting a target.
+	UnhealthyThreshold int `mapstructure:"unhealthyThreshold"`
+	// HealthyThreshold is the number of consecutive successful probes admitting a target.
+	HealthyThreshold int `mapstructure:"healthyThreshold"`
+	// ConsecutiveFailures is the number of consecutive failed requests ejecting a target,
+	// passive checking is disabled if zero.
+	ConsecutiveFailures int `mapstructure:"consecutiveFailures"`
+	// EjectionTime after which a passively ejected target is admitted
+	// if active checking is disabled.
+	EjectionTime time.Duration `mapstructure:"ejectionTime"`
+}
+
+// UpstreamStatus is the health status of an upstream.
+type UpstreamStatus struct {
+	// The name of the upstream.
+	Name string `json:"name"`
+	// The statuses of the targets.
+	Targets []TargetStatus `json:"targets"`
+}
+
+// TargetStatus is the health status of a target.
+type TargetStatus struct {
+	// The url of the target.
+	URL string `json:"url"`
+	// Whether the target is in rotation.
+	Healthy bool `json:"healthy"`
+	// Whether an operator keeps the target out of rotation.
+	Drained bool `json:"drained"`
+	// The number of requests in flight.
+	Outstanding int64 `json:"outstanding"`
+	// The number of consecutive failed requests.
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// The time of the last probe.
+	LastProbe time.Time `json:"lastProbe"`
+	// The error of the last probe.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// targetState is the health checking state of a target.
+type targetState struct {
+	failures       int
+	probeFailures  int
+	probeSuccesses int
+	ejectedAt      time.Time
+	lastProbe      time.Time
+	lastError      string
+}
+
+// watchedUpstream is an upstream with its health checking options.
+type watchedUpstream struct {
+	upstream *upstream.Upstream
+	config   Config
+	checker  *Checker
+}
+
+// Checker checks the health of the upstream targets and takes unhealthy ones out of rotation.
+type Checker struct {
+	mu        *sync.Mutex
+	states    map[*balancer.Target]*targetState
+	upstreams []*watchedUpstream
+	loggr     *logger.Logger
+	stop      chan struct{}
+	wg        *sync.WaitGroup
+}
+
+// NewChecker creates a new instance of the Checker.
+func NewChecker(loggr *logger.Logger) *Checker {
+	return &Checker{
+		mu:     new(sync.Mutex),
+		states: make(map[*balancer.Target]*targetState),
+		loggr:  loggr,
+		stop:   make(chan struct{}),
+		wg:     new(sync.WaitGroup),
+	}
+}
+
+// Watch registers the upstream for health checking, it must be called before Start.
+func (c *Checker) Watch(u *upstream.Upstream, config Config) {
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+
+	if config.Timeout <= 0 || config.Timeout > config.Interval {
+		config.Timeout = config.Interval
+	}
+
+	if config.UnhealthyThreshold < 1 {
+		config.UnhealthyThreshold = 1
+	}
+
+	if config.HealthyThreshold < 1 {
+		config.HealthyThreshold = 1
+	}
+
+	watched := &watchedUpstream{
+		upstream: u,
+		config:   config,
+		checker:  c,
+	}
+
+	c.upstreams = append(c.upstreams, watched)
+
+	u.SetObserver(watched)
+}
+
+// Start runs the health checking loops.
+func (c *Checker) Start() {
+	for _, watched := range c.upstreams {
+		c.wg.Add(1)
+
+		go func(watched *watchedUpstream) {
+			defer c.wg.Done()
+
+			c.checkLoop(watched)
+		}(watched)
+	}
+}
+
+// Stop shuts the health checking loops down.
+func (c *Checker) Stop() {
+	close(c.stop)
+
+	c.wg.Wait()
+}
+
+// Status returns the health status of all the watched upstreams.
+func (c *Checker) Status() []UpstreamStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]UpstreamStatus, 0, len(c.upstreams))
+
+	for _, watched := range c.upstreams {
+		targets := watched.upstream.Balancer().Targets()
+		upstreamStatus := UpstreamStatus{
+			Name:    watched.upstream.Name(),
+			Targets: make([]TargetStatus, 0, len(targets)),
+		}
+
+		for _, target := range targets {
+			state := c.state(target)
+
+			upstreamStatus.Targets = append(upstreamStatus.Targets, TargetStatus{
+				URL:                 target.URL.String(),
+				Healthy:             target.Healthy(),
+				Drained:             target.Drained(),
+				Outstanding:         target.Outstanding(),
+				ConsecutiveFailures: state.failures,
+				LastProbe:           state.lastProbe,
+				LastError:           state.lastError,
+			})
+		}
+
+		statuses = append(statuses, upstreamStatus)
+	}
+
+	return statuses
+}
+
+// Ping checks whether the upstream is reachable by probing its targets in rotation
+// until one of them responds.
+func (c *Checker) Ping(ctx context.Context, name string) error {
+	for _, watched := range c.upstreams {
+		if watched.upstream.Name() != name {
+			continue
+		}
+
+		path := watched.config.Path
+		if path == "" {
+			path = "/"
+		}
+
+		err := balancer.ErrNoTargets
+
+		for _, target := range watched.upstream.Balancer().Targets() {
+			if !target.Healthy() || target.Drained() {
+				continue
+			}
+
+			err = watched.upstream.Probe(ctx, target, path)
+			if err == nil {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("pinging %s: %w", name, err)
+	}
+
+	return fmt.Errorf("%w: %s", errUnknownUpstream, name)
+}
+
+// Prune drops the health checking state of the targets no watched upstream has anymore,
+// it's called after the targets are replaced.
+func (c *Checker) Prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := make(map[*balancer.Target]struct{}, len(c.states))
+
+	for _, watched := range c.upstreams {
+		for _, target := range watched.upstream.Balancer().Targets() {
+			current[target] = struct{}{}
+		}
+	}
+
+	for target := range c.states {
+		if _, ok := current[target]; !ok {
+			delete(c.states, target)
+		}
+	}
+}
+
+// Observe records the result of a request to the target and ejects it
+// after too many consecutive failures.
+func (w *watchedUpstream) Observe(target *balancer.Target, failed bool) {
+	w.checker.mu.Lock()
+	defer w.checker.mu.Unlock()
+
+	state := w.checker.state(target)
+
+	if !failed {
+		state.failures = 0
+
+		return
+	}
+
+	state.failures++
+
+	if w.config.ConsecutiveFailures > 0 && state.failures >= w.config.ConsecutiveFailures && target.Eject() {
+		state.ejectedAt = time.Now()
+
+		w.checker.loggr.Error("ejecting target %s of %s after %d consecutive failures",
+			target.URL, w.upstream.Name(), state.failures)
+	}
+}
+
+// checkLoop periodically checks the targets of the upstream.
+func (c *Checker) checkLoop(watched *watchedUpstream) {
+	ticker := time.NewTicker(watched.config.Interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			// The requests in flight during a reload may have recorded a removed target again.
+			c.Prune()
+
+			for _, target := range watched.upstream.Balancer().Targets() {
+				if watched.config.Path != "" {
+					c.probe(watched, target)
+				} else {
+					c.expireEjection(watched, target)
+				}
+			}
+		}
+	}
+}
+
+// probe actively checks the target and ejects or admits it depending on the result.
+func (c *Checker) probe(watched *watchedUpstream, target *balancer.Target) {
+	ctx, cancel := context.WithTimeout(context.Background(), watched.config.Timeout)
+
+	defer cancel()
+
+	err := watched.upstream.Probe(ctx, target, watched.config.Path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.state(target)
+	state.lastProbe = time.Now()
+
+	if err != nil {
+		state.lastError = err.Error()
+		state.probeSuccesses = 0
+		state.probeFailures++
+
+		if state.probeFailures >= watched.config.UnhealthyThreshold && target.Eject() {
+			state.ejectedAt = time.Now()
+
+			c.loggr.Error("ejecting target %s of %s after %d failed probes: %v",
+				target.URL, watched.upstream.Name(), state.probeFailures, err)
+		}
+
+		return
+	}
+
+	state.lastError = ""
+	state.probeFailures = 0
+	state.probeSuccesses++
+
+	if state.probeSuccesses >= watched.config.HealthyThreshold && target.Admit() {
+		state.failures = 0
+
+		c.loggr.Info("admitting target %s of %s after %d successful probes",
+			target.URL, watched.upstream.Name(), state.probeSuccesses)
+	}
+}
+
+// expireEjection admits a passively ejected target once the ejection time is over.
+func (c *Checker) expireEjection(watched *watchedUpstream, target *balancer.Target) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.state(target)
+
+	if target.Healthy() || time.Since(state.ejectedAt) < watched.config.EjectionTime {
+		return
+	}
+
+	if target.Admit() {
+		state.failures = 0
+
+		c.loggr.Info("admitting target %s of %s after the ejection time", target.URL, watched.upstream.Name())
+	}
+}
+
+// state returns the health checking state of the target, the caller must hold the lock.
+func (c *Checker) state(target *balancer.Target) *targetState {
+	state, ok := c.states[target]
+	if !ok {
+		state = new(targetState)
+		c.states[target] = state
+	}
+
+	return state
+}
@@ -0,0 +1,259 @@
+package healthcheck
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
+)
+
+// testServer is a target responding with the status it's set to.
+type testServer struct {
+	*httptest.Server
+	status atomic.Int64
+}
+
+// newTestServer starts a target responding with the status.
+func newTestServer(t *testing.T, status int) *testServer {
+	t.Helper()
+
+	server := new(testServer)
+	server.status.Store(int64(status))
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(server.status.Load()))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newWatchedUpstream creates a checker watching an upstream of the servers with the config.
+func newWatchedUpstream(t *testing.T, config Config, servers ...*testServer,
+) (*Checker, *upstream.Upstream, []*balancer.Target) {
+	t.Helper()
+
+	targets := make([]*balancer.Target, 0, len(servers))
+
+	for _, server := range servers {
+		target, err := balancer.NewTarget(server.URL, 1)
+		if err != nil {
+			t.Fatalf("creating the target: %v", err)
+		}
+
+		targets = append(targets, target)
+	}
+
+	bal, err := balancer.New(balancer.RoundRobin, targets)
+	if err != nil {
+		t.Fatalf("creating the balancer: %v", err)
+	}
+
+	up := upstream.New("test", bal, http.DefaultTransport)
+
+	checker := NewChecker(logger.NewLogger(io.Discard, "test"))
+	checker.Watch(up, config)
+
+	return checker, up, targets
+}
+
+// waitFor polls the condition until it holds or the test times out.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestActiveProbing(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		wantHealthy []bool
+	}{
+		{
+			name:        "ejected after the unhealthy threshold",
+			statuses:    []int{500, 200, 500, 500},
+			wantHealthy: []bool{true, true, true, false},
+		},
+		{
+			name:        "admitted after the healthy threshold",
+			statuses:    []int{500, 500, 200, 500, 200, 200},
+			wantHealthy: []bool{true, false, false, false, false, true},
+		},
+		{
+			name:        "client errors mean the target is alive",
+			statuses:    []int{404, 401, 404},
+			wantHealthy: []bool{true, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, http.StatusOK)
+			checker, _, targets := newWatchedUpstream(t, Config{
+				Path:               "/health",
+				Interval:           time.Hour,
+				UnhealthyThreshold: 2,
+				HealthyThreshold:   2,
+			}, server)
+
+			for i, status := range tt.statuses {
+				server.status.Store(int64(status))
+				checker.probe(checker.upstreams[0], targets[0])
+
+				if got := targets[0].Healthy(); got != tt.wantHealthy[i] {
+					t.Fatalf("Healthy() after probe %d = %t, want %t", i, got, tt.wantHealthy[i])
+				}
+
+				lastError := checker.Status()[0].Targets[0].LastError
+				if (lastError != "") != (status >= http.StatusInternalServerError) {
+					t.Errorf("LastError after probe %d with status %d = %q", i, status, lastError)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckLoop(t *testing.T) {
+	server := newTestServer(t, http.StatusServiceUnavailable)
+	checker, _, targets := newWatchedUpstream(t, Config{
+		Path:               "/health",
+		Interval:           10 * time.Millisecond,
+		UnhealthyThreshold: 1,
+		HealthyThreshold:   1,
+	}, server)
+
+	checker.Start()
+	defer checker.Stop()
+
+	waitFor(t, "the failing target to be ejected", func() bool { return !targets[0].Healthy() })
+
+	server.status.Store(http.StatusOK)
+
+	waitFor(t, "the recovered target to be admitted", targets[0].Healthy)
+}
+
+func TestPassiveEjection(t *testing.T) {
+	tests := []struct {
+		name                string
+		consecutiveFailures int
+		results             []bool
+		wantHealthy         bool
+	}{
+		{name: "consecutive failures", consecutiveFailures: 3, results: []bool{true, true, true}},
+		{
+			name:                "success resets the count",
+			consecutiveFailures: 3,
+			results:             []bool{true, true, false, true, true},
+			wantHealthy:         true,
+		},
+		{name: "disabled", consecutiveFailures: 0, results: []bool{true, true, true, true}, wantHealthy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, _, targets := newWatchedUpstream(t, Config{ConsecutiveFailures: tt.consecutiveFailures},
+				newTestServer(t, http.StatusOK))
+
+			for _, failed := range tt.results {
+				checker.upstreams[0].Observe(targets[0], failed)
+			}
+
+			if got := targets[0].Healthy(); got != tt.wantHealthy {
+				t.Errorf("Healthy() = %t, want %t", got, tt.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestPassiveEjectionThroughTheUpstream(t *testing.T) {
+	server := newTestServer(t, http.StatusInternalServerError)
+	_, up, targets := newWatchedUpstream(t, Config{ConsecutiveFailures: 2}, server)
+
+	// The requests cancelled by the caller aren't failures of the target.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 3; i++ {
+		if _, err := up.DoTarget(ctx, targets[0], http.MethodGet, "/", nil); err == nil {
+			t.Fatal("DoTarget() with a cancelled context succeeded")
+		}
+	}
+
+	if !targets[0].Healthy() {
+		t.Fatal("the target was ejected after the cancelled requests")
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := up.DoTarget(context.Background(), targets[0], http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatalf("DoTarget() error = %v", err)
+		}
+
+		_ = resp.Body.Close()
+	}
+
+	if targets[0].Healthy() {
+		t.Error("the target failing with 500 wasn't ejected")
+	}
+}
+
+func TestEjectionExpiry(t *testing.T) {
+	checker, _, targets := newWatchedUpstream(t, Config{ConsecutiveFailures: 1, EjectionTime: 30 * time.Millisecond},
+		newTestServer(t, http.StatusOK))
+	watched := checker.upstreams[0]
+
+	watched.Observe(targets[0], true)
+
+	checker.expireEjection(watched, targets[0])
+
+	if targets[0].Healthy() {
+		t.Fatal("the target was admitted before the ejection time")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	checker.expireEjection(watched, targets[0])
+
+	if !targets[0].Healthy() {
+		t.Fatal("the target wasn't admitted after the ejection time")
+	}
+
+	if got := checker.Status()[0].Targets[0].ConsecutiveFailures; got != 0 {
+		t.Errorf("ConsecutiveFailures after the admission = %d, want 0", got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	checker, up, targets := newWatchedUpstream(t, Config{ConsecutiveFailures: 5},
+		newTestServer(t, http.StatusOK), newTestServer(t, http.StatusOK))
+
+	for _, target := range targets {
+		checker.upstreams[0].Observe(target, true)
+	}
+
+	bal, err := balancer.New(balancer.RoundRobin, targets[:1])
+	if err != nil {
+		t.Fatalf("creating the balancer: %v", err)
+	}
+
+	up.SetBalancer(bal)
+	checker.Prune()
+
+	if _, ok := checker.states[targets[1]]; ok || len(checker.states) != 1 {
+		t.Errorf("states = %v, want only the state of the remaining target", checker.states)
+	}
+}
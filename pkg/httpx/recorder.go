@@ -0,0 +1,65 @@
+// Package httpx provides the helpers shared by the HTTP middlewares.
+package httpx
+
+import "net/http"
+
+// Recorder records the status and the size of the response written through it.
+type Recorder struct {
+	http.ResponseWriter
+	// The first status written, zero until the handler writes the header or the body.
+	status int
+	// The number of the body bytes written.
+	bytes int64
+}
+
+// NewRecorder creates a new instance of the Recorder writing to the response writer.
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+// WriteHeader records the status and writes it to the response.
+func (r *Recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the data and writes it to the response.
+func (r *Recorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	written, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(written)
+
+	return written, err //nolint:wrapcheck
+}
+
+// Status returns the recorded status, 200 if none was written explicitly.
+func (r *Recorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
+
+// Bytes returns the number of the body bytes written.
+func (r *Recorder) Bytes() int64 {
+	return r.bytes
+}
+
+// Flush sends the buffered data to the client if the response supports it.
+func (r *Recorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped response writer.
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
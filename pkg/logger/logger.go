@@ -2,13 +2,80 @@
 package logger
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+)
+
+// Level is the severity of a message.
+type Level int32
+
+// Levels of the messages, the messages below the level set with SetLevel are dropped.
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelError
 )
 
+var errUnknownLevel = errors.New("unknown log level")
+
+// minLevel is the level shared by all the loggers, info by default.
+var minLevel atomic.Int32 //nolint:gochecknoglobals
+
+// SetLevel sets the minimum level of the logged messages of all the loggers.
+func SetLevel(level Level) {
+	minLevel.Store(int32(level))
+}
+
+// CurrentLevel returns the minimum level of the logged messages.
+func CurrentLevel() Level {
+	return Level(minLevel.Load())
+}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+}
+
+// ParseLevel returns the level with the specified name: debug, info or error.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("%w: %q", errUnknownLevel, name)
+	}
+}
+
+// enabled reports whether the messages of the level are logged.
+func enabled(level Level) bool {
+	return int32(level) >= minLevel.Load()
+}
+
 // Logger is a custom logger implementation for application use.
 type Logger struct {
 	logger *log.Logger
+	// fields are prepended to every message.
+	fields string
 }
 
 // NewLogger returns new Logger instance.
@@ -20,17 +87,46 @@ func NewLogger(output io.Writer, prefix string) *Logger {
 	}
 }
 
+// WithContext returns a Logger adding the request ID carried by the context to every message.
+func (l Logger) WithContext(ctx context.Context) *Logger {
+	requestID := requestctx.RequestID(ctx)
+	if requestID == "" {
+		return &l
+	}
+
+	return &Logger{
+		logger: l.logger,
+		fields: l.fields + "request_id=" + requestID + " ",
+	}
+}
+
 // Error logs error in a Printf way.
 func (l Logger) Error(format string, args ...any) {
-	l.logger.Printf("ERROR "+format, args...)
+	if enabled(LevelError) {
+		l.logger.Printf("ERROR "+l.fields+format, args...)
+	}
 }
 
 // Info logs information in a Printf way.
 func (l Logger) Info(format string, args ...any) {
-	l.logger.Printf("INFO "+format, args...)
+	if enabled(LevelInfo) {
+		l.logger.Printf("INFO "+l.fields+format, args...)
+	}
+}
+
+// Debug logs diagnostic details in a Printf way.
+func (l Logger) Debug(format string, args ...any) {
+	if enabled(LevelDebug) {
+		l.logger.Printf("DEBUG "+l.fields+format, args...)
+	}
+}
+
+// Audit logs a record of the audit trail in a Printf way, whatever the level is.
+func (l Logger) Audit(format string, args ...any) {
+	l.logger.Printf("AUDIT "+l.fields+format, args...)
 }
 
 // Fatal logs fatal error in a Panicf way.
 func (l Logger) Fatal(format string, args ...any) {
-	l.logger.Panicf("FATAL "+format, args...)
+	l.logger.Panicf("FATAL "+l.fields+format, args...)
 }
@@ -0,0 +1,286 @@
+// Package maintenance answers the requests with a static fallback response while the upstreams are under maintenance.
+package maintenance
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/clientip"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+)
+
+// BypassHeader carries one of the bypass tokens letting the request through the maintenance.
+const BypassHeader = "X-Maintenance-Bypass"
+
+// defaultMessage is the message of the fallback responses if none is configured.
+const defaultMessage = "the service is under maintenance, please try again later"
+
+// defaultPage is the HTML fallback response if no file is configured, formatted with the escaped message.
+const defaultPage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Under maintenance</title></head>
+<body><h1>Under maintenance</h1><p>%s</p></body>
+</html>
+`
+
+// Config configures the maintenance mode.
+type Config struct {
+	// Enabled turns the maintenance on.
+	Enabled bool `mapstructure:"enabled"`
+	// Routes are the names of the routes under maintenance, all the routes if empty.
+	Routes []string `mapstructure:"routes"`
+	// RetryAfter is sent in the Retry-After header, omitted if zero.
+	RetryAfter time.Duration `mapstructure:"retryAfter"`
+	// Message is the detail of the JSON response and the text of the default HTML page.
+	Message string `mapstructure:"message"`
+	// JSONFile and HTMLFile replace the default responses with their content if set.
+	JSONFile string `mapstructure:"jsonFile"`
+	HTMLFile string `mapstructure:"htmlFile"`
+	// AllowedIPs are the IP addresses and CIDRs of the clients let through.
+	AllowedIPs []string `mapstructure:"allowedIPs"`
+	// BypassTokens let the requests carrying one of them in the BypassHeader through.
+	BypassTokens []string `mapstructure:"bypassTokens"`
+}
+
+// Status is the scope of the maintenance.
+type Status struct {
+	// Whether the maintenance is on.
+	Enabled bool `json:"enabled"`
+	// The names of the routes under maintenance, all the routes if empty.
+	Routes []string `json:"routes"`
+}
+
+// state is the config prepared for serving.
+type state struct {
+	config Config
+	// The scope of the last config set, kept to tell a changed config from a toggle.
+	configured Status
+	routes     map[string]bool
+	networks   []*net.IPNet
+	jsonBody   []byte
+	htmlBody   []byte
+}
+
+// Mode decides whether the requests are answered with the maintenance response,
+// it can be reconfigured and toggled while serving.
+type Mode struct {
+	// The state in use.
+	state atomic.Pointer[state]
+	// Serializes the replacements of the state, the requests read it without locking.
+	mu *sync.Mutex
+	// Resolves the IP address of the clients matched against the allowed IPs.
+	resolver *clientip.Resolver
+}
+
+// Settings is a config of the maintenance with its responses read, ready to be applied.
+type Settings struct {
+	// The state applied.
+	state *state
+}
+
+// NewMode creates a new instance of the Mode with the config, the IP addresses of the clients are resolved
+// with the resolver.
+func NewMode(config Config, resolver *clientip.Resolver) (*Mode, error) {
+	mode := &Mode{
+		mu:       new(sync.Mutex),
+		resolver: resolver,
+	}
+
+	if err := mode.Set(config); err != nil {
+		return nil, err
+	}
+
+	return mode, nil
+}
+
+// Load reads the config and its response files, so a config failing to load is rejected
+// before anything is applied.
+func Load(config Config) (*Settings, error) {
+	networks, err := clientip.ParseNetworks(config.AllowedIPs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the allowed IPs: %w", err)
+	}
+
+	if config.Message == "" {
+		config.Message = defaultMessage
+	}
+
+	newState := &state{
+		config:     config,
+		configured: Status{Enabled: config.Enabled, Routes: config.Routes},
+		routes:     routeSet(config.Routes),
+		networks:   networks,
+		htmlBody:   []byte(fmt.Sprintf(defaultPage, html.EscapeString(config.Message))),
+	}
+
+	if config.JSONFile != "" {
+		newState.jsonBody, err = os.ReadFile(config.JSONFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the JSON response: %w", err)
+		}
+	}
+
+	if config.HTMLFile != "" {
+		newState.htmlBody, err = os.ReadFile(config.HTMLFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the HTML response: %w", err)
+		}
+	}
+
+	return &Settings{state: newState}, nil
+}
+
+// Set loads the config and applies it, the current one is kept if the config is invalid.
+func (m *Mode) Set(config Config) error {
+	settings, err := Load(config)
+	if err != nil {
+		return err
+	}
+
+	m.Apply(settings)
+
+	return nil
+}
+
+// Apply replaces the config of the maintenance with the loaded settings.
+// The scope set by Toggle is kept until the enabled flag or the routes of the config change.
+func (m *Mode) Apply(settings *Settings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newState := *settings.state
+
+	if current := m.state.Load(); current != nil && current.configured.equal(newState.configured) {
+		newState.config.Enabled = current.config.Enabled
+		newState.config.Routes = current.config.Routes
+		newState.routes = current.routes
+	}
+
+	m.state.Store(&newState)
+}
+
+// Toggle turns the maintenance of the routes on or off, all the routes if none is specified.
+// The responses and the allow-lists of the config are kept.
+func (m *Mode) Toggle(enabled bool, routes []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	toggled := *m.state.Load()
+	toggled.config.Enabled = enabled
+	toggled.config.Routes = routes
+	toggled.routes = routeSet(routes)
+
+	m.state.Store(&toggled)
+}
+
+// Status returns the scope of the maintenance.
+func (m *Mode) Status() Status {
+	current := m.state.Load()
+
+	routes := make([]string, len(current.config.Routes))
+	copy(routes, current.config.Routes)
+
+	return Status{
+		Enabled: current.config.Enabled,
+		Routes:  routes,
+	}
+}
+
+// equal reports whether the scopes are the same.
+func (s Status) equal(other Status) bool {
+	if s.Enabled != other.Enabled || len(s.Routes) != len(other.Routes) {
+		return false
+	}
+
+	for i, route := range s.Routes {
+		if other.Routes[i] != route {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Intercept answers the request of the route with the maintenance response if the route is under maintenance
+// and the client isn't let through, it reports whether the request is answered.
+func (m *Mode) Intercept(w http.ResponseWriter, req *http.Request, route string) bool {
+	current := m.state.Load()
+
+	underMaintenance := current.config.Enabled && (len(current.routes) == 0 || current.routes[route])
+	if !underMaintenance || current.bypassed(req, m.resolver) {
+		return false
+	}
+
+	if current.config.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(current.config.RetryAfter.Seconds()))))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch {
+	case acceptsHTML(req):
+		writeBody(w, "text/html; charset=utf-8", current.htmlBody)
+	case current.jsonBody != nil:
+		writeBody(w, "application/json", current.jsonBody)
+	default:
+		problem.Write(w, req, http.StatusServiceUnavailable, current.config.Message)
+	}
+
+	return true
+}
+
+// bypassed reports whether the client of the request is let through the maintenance.
+func (s *state) bypassed(req *http.Request, resolver *clientip.Resolver) bool {
+	if token := req.Header.Get(BypassHeader); token != "" {
+		for _, bypassToken := range s.config.BypassTokens {
+			if bypassToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(bypassToken)) == 1 {
+				return true
+			}
+		}
+	}
+
+	if len(s.networks) == 0 {
+		return false
+	}
+
+	ip := net.ParseIP(resolver.IP(req))
+	if ip == nil {
+		return false
+	}
+
+	return clientip.Contains(s.networks, ip)
+}
+
+// routeSet returns the set of the route names.
+func routeSet(routes []string) map[string]bool {
+	set := make(map[string]bool, len(routes))
+
+	for _, route := range routes {
+		set[route] = true
+	}
+
+	return set
+}
+
+// acceptsHTML reports whether the client of the request asks for an HTML page, e.g. a browser.
+func acceptsHTML(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/html")
+}
+
+// writeBody writes the maintenance response with the content type and the body.
+func writeBody(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	_, _ = w.Write(body)
+}
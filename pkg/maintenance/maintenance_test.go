@@ -0,0 +1,274 @@
+package maintenance
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+)
+
+// newTestMode creates a mode with the config.
+func newTestMode(t *testing.T, config Config) *Mode {
+	t.Helper()
+
+	mode, err := NewMode(config, nil)
+	if err != nil {
+		t.Fatalf("NewMode() error = %v", err)
+	}
+
+	return mode
+}
+
+// intercept sends a request of the route from the address with the headers through the mode.
+func intercept(mode *Mode, route, remoteAddr string, header map[string]string) (*httptest.ResponseRecorder, bool) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/market/1", nil)
+	req.RemoteAddr = remoteAddr
+
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	return recorder, mode.Intercept(recorder, req, route)
+}
+
+// writeFile writes the content to the file in the directory and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+
+	return path
+}
+
+func TestInterceptScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		route  string
+		want   bool
+	}{
+		{name: "disabled", config: Config{}, route: "market"},
+		{name: "all the routes", config: Config{Enabled: true}, route: "auth", want: true},
+		{name: "listed route", config: Config{Enabled: true, Routes: []string{"market"}}, route: "market", want: true},
+		{name: "unlisted route", config: Config{Enabled: true, Routes: []string{"market"}}, route: "auth"},
+		{name: "routes of a disabled config", config: Config{Routes: []string{"market"}}, route: "market"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := newTestMode(t, tt.config)
+
+			recorder, got := intercept(mode, tt.route, "203.0.113.7:4321", nil)
+			if got != tt.want {
+				t.Fatalf("Intercept() = %t, want %t", got, tt.want)
+			}
+
+			if got && recorder.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+func TestInterceptAllowLists(t *testing.T) {
+	config := Config{
+		Enabled:      true,
+		AllowedIPs:   []string{"10.0.0.0/8", "2001:db8::1"},
+		BypassTokens: []string{"", "abcdefghijklmnop1234"},
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		want       bool
+	}{
+		{name: "client outside of the allowed IPs", remoteAddr: "203.0.113.7:4321", want: true},
+		{name: "allowed network", remoteAddr: "10.1.2.3:4321"},
+		{name: "allowed IPv6 address", remoteAddr: "[2001:db8::1]:4321"},
+		{name: "bypass token", remoteAddr: "203.0.113.7:4321", token: "abcdefghijklmnop1234"},
+		{name: "wrong bypass token", remoteAddr: "203.0.113.7:4321", token: "abcdefghijklmnop1235", want: true},
+		{name: "empty bypass token", remoteAddr: "203.0.113.7:4321", token: "", want: true},
+	}
+
+	mode := newTestMode(t, config)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got := intercept(mode, "market", tt.remoteAddr, map[string]string{BypassHeader: tt.token})
+			if got != tt.want {
+				t.Errorf("Intercept() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterceptRetryAfter(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                       "",
+		30 * time.Second:        "30",
+		1500 * time.Millisecond: "2",
+	}
+
+	for retryAfter, want := range tests {
+		mode := newTestMode(t, Config{Enabled: true, RetryAfter: retryAfter})
+
+		recorder, _ := intercept(mode, "market", "203.0.113.7:4321", nil)
+		if got := recorder.Header().Get("Retry-After"); got != want {
+			t.Errorf("Retry-After of %s = %q, want %q", retryAfter, got, want)
+		}
+	}
+}
+
+func TestInterceptNegotiation(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := writeFile(t, dir, "maintenance.json", `{"status":"maintenance"}`)
+	htmlFile := writeFile(t, dir, "maintenance.html", "<p>back soon</p>")
+
+	tests := []struct {
+		name            string
+		config          Config
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "problem by default",
+			config:          Config{Enabled: true, Message: "back at noon"},
+			accept:          "application/json",
+			wantContentType: problem.ContentType,
+			wantBody:        `"detail":"back at noon"`,
+		},
+		{
+			name:            "JSON file",
+			config:          Config{Enabled: true, JSONFile: jsonFile},
+			accept:          "*/*",
+			wantContentType: "application/json",
+			wantBody:        `{"status":"maintenance"}`,
+		},
+		{
+			name:            "default page for browsers",
+			config:          Config{Enabled: true, Message: "back <soon>", JSONFile: jsonFile},
+			accept:          "text/html,application/xhtml+xml",
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<p>back &lt;soon&gt;</p>",
+		},
+		{
+			name:            "HTML file for browsers",
+			config:          Config{Enabled: true, HTMLFile: htmlFile},
+			accept:          "text/html",
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<p>back soon</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := newTestMode(t, tt.config)
+
+			recorder, _ := intercept(mode, "market", "203.0.113.7:4321", map[string]string{"Accept": tt.accept})
+
+			if got := recorder.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+
+			if got := recorder.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+
+			if body := recorder.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLoadMissingFileKeepsTheCurrentConfig(t *testing.T) {
+	mode := newTestMode(t, Config{Enabled: true})
+
+	_, err := Load(Config{Enabled: false, JSONFile: filepath.Join(t.TempDir(), "missing.json")})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Load() error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	if err := mode.Set(Config{JSONFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Fatal("Set() with a missing file succeeded")
+	}
+
+	if !mode.Status().Enabled {
+		t.Error("the maintenance was turned off by the rejected config")
+	}
+}
+
+func TestToggleKeptUntilTheConfigChanges(t *testing.T) {
+	mode := newTestMode(t, Config{Message: "first"})
+	mode.Toggle(true, []string{"market"})
+
+	// The same scope with another message keeps the toggled scope.
+	if err := mode.Set(Config{Message: "second"}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if status := mode.Status(); !status.Enabled || len(status.Routes) != 1 {
+		t.Fatalf("Status() = %+v, want the toggled scope", status)
+	}
+
+	if _, got := intercept(mode, "auth", "203.0.113.7:4321", nil); got {
+		t.Error("the route out of the toggled scope was intercepted")
+	}
+
+	// Another configured scope replaces the toggled one.
+	if err := mode.Set(Config{Enabled: false, Routes: []string{"auth"}}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if status := mode.Status(); status.Enabled {
+		t.Errorf("Status() = %+v, want the configured scope", status)
+	}
+}
+
+func TestToggleAndSetConcurrently(t *testing.T) {
+	mode := newTestMode(t, Config{})
+
+	settings, err := Load(Config{Message: "reloaded"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			mode.Toggle(true, nil)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			mode.Apply(settings)
+		}()
+	}
+
+	wg.Wait()
+
+	// The config never changed scope, so every toggle survives the applies.
+	if !mode.Status().Enabled {
+		t.Error("a toggle was lost to a concurrent apply")
+	}
+}
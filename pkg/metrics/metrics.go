@@ -0,0 +1,412 @@
+// Package metrics provides metrics exposed in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the histogram buckets suited for request durations in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10} //nolint:gochecknoglobals
+
+// collector writes its metric families in the text format.
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics and writes them in the Prometheus text format.
+type Registry struct {
+	mu         *sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates a new instance of the Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		mu: new(sync.Mutex),
+	}
+}
+
+// register adds the collector to the registry.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all the metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+
+	counter := &countingWriter{writer: w}
+	buf := bufio.NewWriter(counter)
+
+	for _, c := range collectors {
+		c.write(buf)
+	}
+
+	if err := buf.Flush(); err != nil {
+		return counter.written, fmt.Errorf("writing the metrics: %w", err)
+	}
+
+	return counter.written, nil
+}
+
+// ServeHTTP writes all the metrics in the Prometheus text format to the response.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+
+	_, _ = r.WriteTo(w)
+}
+
+// vec holds the series of a metric family by their label values.
+type vec[T any] struct {
+	mu         *sync.Mutex
+	name       string
+	help       string
+	metricType string
+	labels     []string
+	series     map[string]*T
+	values     map[string][]string
+	create     func() *T
+}
+
+// with returns the series with the label values, creating it if needed.
+func (v *vec[T]) with(labelValues []string) *T {
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	series, ok := v.series[key]
+	if !ok {
+		series = v.create()
+		v.series[key] = series
+		v.values[key] = append([]string(nil), labelValues...)
+	}
+
+	return series
+}
+
+// each calls fn for every series sorted by the label values.
+func (v *vec[T]) each(fn func(labels string, series *T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	type entry struct {
+		labels string
+		series *T
+	}
+
+	entries := make([]entry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, entry{labels: formatLabels(v.labels, v.values[key]), series: v.series[key]})
+	}
+	v.mu.Unlock()
+
+	for _, e := range entries {
+		fn(e.labels, e.series)
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of the metric family.
+func (v *vec[T]) writeHeader(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, v.metricType)
+}
+
+// newVec creates the series holder of a metric family.
+func newVec[T any](name, help, metricType string, labels []string, create func() *T) *vec[T] {
+	return &vec[T]{
+		mu:         new(sync.Mutex),
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labels:     labels,
+		series:     make(map[string]*T),
+		values:     make(map[string][]string),
+		create:     create,
+	}
+}
+
+// value is a float64 updated atomically.
+type value struct {
+	mu  sync.Mutex
+	val float64
+}
+
+// add adds the delta to the value.
+func (v *value) add(delta float64) {
+	v.mu.Lock()
+	v.val += delta
+	v.mu.Unlock()
+}
+
+// set sets the value.
+func (v *value) set(val float64) {
+	v.mu.Lock()
+	v.val = val
+	v.mu.Unlock()
+}
+
+// get returns the value.
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.val
+}
+
+// CounterVec is a family of counters partitioned by labels.
+type CounterVec struct {
+	vec *vec[value]
+}
+
+// NewCounterVec creates and registers a family of counters.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{vec: newVec(name, help, "counter", labels, func() *value { return new(value) })}
+	r.register(counter)
+
+	return counter
+}
+
+// Inc increments the counter with the label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.vec.with(labelValues).add(1)
+}
+
+// Add adds the non-negative delta to the counter with the label values.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta > 0 {
+		c.vec.with(labelValues).add(delta)
+	}
+}
+
+// write writes the counters in the text format.
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.vec.writeHeader(w)
+	c.vec.each(func(labels string, series *value) {
+		writeSample(w, c.vec.name, labels, series.get())
+	})
+}
+
+// GaugeVec is a family of gauges partitioned by labels.
+type GaugeVec struct {
+	vec *vec[value]
+}
+
+// NewGaugeVec creates and registers a family of gauges.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	gauge := &GaugeVec{vec: newVec(name, help, "gauge", labels, func() *value { return new(value) })}
+	r.register(gauge)
+
+	return gauge
+}
+
+// Set sets the gauge with the label values.
+func (g *GaugeVec) Set(val float64, labelValues ...string) {
+	g.vec.with(labelValues).set(val)
+}
+
+// Add adds the delta to the gauge with the label values.
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.vec.with(labelValues).add(delta)
+}
+
+// write writes the gauges in the text format.
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.vec.writeHeader(w)
+	g.vec.each(func(labels string, series *value) {
+		writeSample(w, g.vec.name, labels, series.get())
+	})
+}
+
+// histogram is a single histogram series.
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	vec     *vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a family of histograms with the upper bounds of the buckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	hist := &HistogramVec{
+		vec: newVec(name, help, "histogram", labels, func() *histogram {
+			return &histogram{counts: make([]uint64, len(sorted))}
+		}),
+		buckets: sorted,
+	}
+	r.register(hist)
+
+	return hist
+}
+
+// Observe adds the observation to the histogram with the label values.
+func (h *HistogramVec) Observe(observation float64, labelValues ...string) {
+	series := h.vec.with(labelValues)
+
+	series.mu.Lock()
+	defer series.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if observation <= bound {
+			series.counts[i]++
+		}
+	}
+
+	series.sum += observation
+	series.count++
+}
+
+// write writes the histograms in the text format.
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.vec.writeHeader(w)
+	h.vec.each(func(labels string, series *histogram) {
+		series.mu.Lock()
+		counts := append([]uint64(nil), series.counts...)
+		sum, count := series.sum, series.count
+		series.mu.Unlock()
+
+		for i, bound := range h.buckets {
+			writeSample(w, h.vec.name+"_bucket", appendLabel(labels, "le", formatFloat(bound)), float64(counts[i]))
+		}
+
+		writeSample(w, h.vec.name+"_bucket", appendLabel(labels, "le", "+Inf"), float64(count))
+		writeSample(w, h.vec.name+"_sum", labels, sum)
+		writeSample(w, h.vec.name+"_count", labels, float64(count))
+	})
+}
+
+// funcMetric is a metric reading its value on every scrape.
+type funcMetric struct {
+	name       string
+	help       string
+	metricType string
+	fn         func() float64
+}
+
+// NewGaugeFunc registers a gauge reading its value from fn on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{name: name, help: help, metricType: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter reading its value from fn on every scrape.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{name: name, help: help, metricType: "counter", fn: fn})
+}
+
+// write writes the metric in the text format.
+func (f *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, f.name, f.help, f.metricType)
+	writeSample(w, f.name, "", f.fn())
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric family.
+func writeHeader(w *bufio.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, metricType)
+}
+
+// writeSample writes a sample line.
+func writeSample(w *bufio.Writer, name, labels string, val float64) {
+	if labels != "" {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatFloat(val))
+
+		return
+	}
+
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(val))
+}
+
+// formatLabels formats the label pairs without the braces.
+func formatLabels(names, values []string) string {
+	pairs := make([]string, 0, len(names))
+
+	for i, name := range names {
+		val := ""
+		if i < len(values) {
+			val = values[i]
+		}
+
+		pairs = append(pairs, name+`="`+escapeLabel(val)+`"`)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// appendLabel appends a label pair to the formatted labels.
+func appendLabel(labels, name, val string) string {
+	pair := name + `="` + escapeLabel(val) + `"`
+	if labels == "" {
+		return pair
+	}
+
+	return labels + "," + pair
+}
+
+// formatFloat formats the value as the text format expects it.
+func formatFloat(val float64) string {
+	switch {
+	case math.IsInf(val, 1):
+		return "+Inf"
+	case math.IsInf(val, -1):
+		return "-Inf"
+	case math.IsNaN(val):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	}
+}
+
+// escapeLabel escapes the label value.
+func escapeLabel(val string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(val)
+}
+
+// escapeHelp escapes the help text.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// countingWriter counts the written bytes.
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+// Write writes the data and counts it.
+func (c *countingWriter) Write(data []byte) (int, error) {
+	written, err := c.writer.Write(data)
+	c.written += int64(written)
+
+	return written, err //nolint:wrapcheck
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape returns the metrics of the registry in the text format.
+func scrape(t *testing.T, reg *Registry) string {
+	t.Helper()
+
+	var out strings.Builder
+
+	written, err := reg.WriteTo(&out)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	if written != int64(out.Len()) {
+		t.Errorf("WriteTo() = %d bytes, wrote %d", written, out.Len())
+	}
+
+	return out.String()
+}
+
+func TestExposition(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(reg *Registry)
+		want     string
+	}{
+		{
+			name: "counter",
+			register: func(reg *Registry) {
+				requests := reg.NewCounterVec("requests_total", "Number of requests.", "route", "status")
+				requests.Inc("/b", "200")
+				requests.Inc("/a", "500")
+				requests.Add(2, "/a", "500")
+				requests.Add(-1, "/a", "500")
+			},
+			want: `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="/a",status="500"} 3
+requests_total{route="/b",status="200"} 1
+`,
+		},
+		{
+			name: "gauge",
+			register: func(reg *Registry) {
+				inFlight := reg.NewGaugeVec("in_flight", "Number of requests in flight.", "upstream")
+				inFlight.Set(5, "market")
+				inFlight.Add(-1.5, "market")
+			},
+			want: `# HELP in_flight Number of requests in flight.
+# TYPE in_flight gauge
+in_flight{upstream="market"} 3.5
+`,
+		},
+		{
+			name: "histogram",
+			register: func(reg *Registry) {
+				duration := reg.NewHistogramVec("duration_seconds", "Request duration.", []float64{1, 0.1}, "route")
+				duration.Observe(0.05, "/a")
+				duration.Observe(0.5, "/a")
+				duration.Observe(3, "/a")
+			},
+			want: `# HELP duration_seconds Request duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/a",le="0.1"} 1
+duration_seconds_bucket{route="/a",le="1"} 2
+duration_seconds_bucket{route="/a",le="+Inf"} 3
+duration_seconds_sum{route="/a"} 3.55
+duration_seconds_count{route="/a"} 3
+`,
+		},
+		{
+			name: "functions",
+			register: func(reg *Registry) {
+				reg.NewGaugeFunc("cache_entries", "Number of cached entries.", func() float64 { return 7 })
+				reg.NewCounterFunc("cache_hits_total", "Number of cache hits.", func() float64 { return 42 })
+			},
+			want: `# HELP cache_entries Number of cached entries.
+# TYPE cache_entries gauge
+cache_entries 7
+# HELP cache_hits_total Number of cache hits.
+# TYPE cache_hits_total counter
+cache_hits_total 42
+`,
+		},
+		{
+			name: "family without series",
+			register: func(reg *Registry) {
+				reg.NewCounterVec("errors_total", "Number of errors.", "kind")
+			},
+			want: `# HELP errors_total Number of errors.
+# TYPE errors_total counter
+`,
+		},
+		{
+			name: "escaping",
+			register: func(reg *Registry) {
+				reg.NewCounterVec("paths_total", "Number of paths\nby \\ path.", "path").Inc("/a\"b\\c\nd")
+			},
+			want: `# HELP paths_total Number of paths\nby \\ path.
+# TYPE paths_total counter
+paths_total{path="/a\"b\\c\nd"} 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := NewRegistry()
+			tt.register(reg)
+
+			if got := scrape(t, reg); got != tt.want {
+				t.Errorf("exposition =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := map[float64]string{
+		0:            "0",
+		1.5:          "1.5",
+		1e21:         "1e+21",
+		math.Inf(1):  "+Inf",
+		math.Inf(-1): "-Inf",
+		math.NaN():   "NaN",
+	}
+
+	for val, want := range tests {
+		if got := formatFloat(val); got != want {
+			t.Errorf("formatFloat(%v) = %q, want %q", val, got, want)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterVec("requests_total", "Number of requests.").Inc()
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+
+	if !strings.Contains(rec.Body.String(), "\nrequests_total 1\n") {
+		t.Errorf("body = %q, want the requests_total sample", rec.Body.String())
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterRuntime()
+
+	got := scrape(t, reg)
+
+	for _, name := range []string{"go_goroutines", "go_memstats_alloc_bytes", "process_start_time_seconds"} {
+		if !strings.Contains(got, "# TYPE "+name+" ") || !strings.Contains(got, "\n"+name+" ") {
+			t.Errorf("exposition lacks the %s metric:\n%s", name, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bufio"
+	"runtime"
+	"time"
+)
+
+// runtimeCollector writes the Go runtime statistics, reading them once per scrape.
+type runtimeCollector struct {
+	startTime time.Time
+}
+
+// RegisterRuntime registers the Go runtime and process metrics.
+func (r *Registry) RegisterRuntime() {
+	r.register(&runtimeCollector{startTime: time.Now()})
+}
+
+// write writes the runtime metrics in the text format.
+func (c *runtimeCollector) write(w *bufio.Writer) {
+	var stats runtime.MemStats
+
+	runtime.ReadMemStats(&stats)
+
+	samples := []struct {
+		name, help, metricType string
+		val                    float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine())},
+		{"go_threads", "Number of OS threads created.", "gauge", float64(threadCount())},
+		{"go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge", float64(stats.Alloc)},
+		{
+			"go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", "counter",
+			float64(stats.TotalAlloc),
+		},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from system.", "gauge", float64(stats.Sys)},
+		{"go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "gauge", float64(stats.HeapInuse)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", "gauge", float64(stats.HeapObjects)},
+		{"go_gc_cycles_total", "Number of completed GC cycles.", "counter", float64(stats.NumGC)},
+		{
+			"go_gc_pause_seconds_total", "Total time spent in GC stop-the-world pauses.", "counter",
+			time.Duration(stats.PauseTotalNs).Seconds(), //nolint:gosec
+		},
+		{
+			"process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "gauge",
+			float64(c.startTime.UnixNano()) / float64(time.Second),
+		},
+	}
+
+	for _, sample := range samples {
+		writeHeader(w, sample.name, sample.help, sample.metricType)
+		writeSample(w, sample.name, "", sample.val)
+	}
+}
+
+// threadCount returns the number of OS threads created.
+func threadCount() int {
+	count, _ := runtime.ThreadCreateProfile(nil)
+
+	return count
+}
@@ -0,0 +1,155 @@
+// Package probe provides liveness and readiness reports of the application.
+package probe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of the reports and dependencies.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+const shutdownDependency = "shutdown"
+
+var errDraining = errors.New("the application is shutting down")
+
+// Check reports whether a dependency is available.
+type Check func(ctx context.Context) error
+
+// Report is the result of a liveness or readiness probe.
+type Report struct {
+	// The overall status.
+	Status string `json:"status"`
+	// The statuses of the dependencies.
+	Dependencies []DependencyStatus `json:"dependencies,omitempty"`
+}
+
+// DependencyStatus is the result of a dependency check.
+type DependencyStatus struct {
+	// The name of the dependency.
+	Name string `json:"name"`
+	// The status of the dependency.
+	Status string `json:"status"`
+	// The time the check took.
+	Latency string `json:"latency"`
+	// The error of the check.
+	Error string `json:"error,omitempty"`
+}
+
+// dependency is a named dependency check.
+type dependency struct {
+	name  string
+	check Check
+}
+
+// Probe checks the liveness and readiness of the application.
+type Probe struct {
+	// The readiness dependencies.
+	dependencies []dependency
+	// The timeout of the readiness checks.
+	timeout time.Duration
+	// Whether the application is shutting down.
+	draining atomic.Bool
+}
+
+// NewProbe creates a new instance of the Probe.
+func NewProbe(timeout time.Duration) *Probe {
+	return &Probe{
+		timeout: timeout,
+	}
+}
+
+// AddDependency registers a dependency checked by the readiness probe, it must be called before serving.
+func (p *Probe) AddDependency(name string, check Check) {
+	p.dependencies = append(p.dependencies, dependency{
+		name:  name,
+		check: check,
+	})
+}
+
+// Drain makes the readiness probe fail, so no new traffic is routed during shutdown.
+func (p *Probe) Drain() {
+	p.draining.Store(true)
+}
+
+// Liveness reports whether the process is up.
+func (p *Probe) Liveness() Report {
+	return Report{
+		Status: StatusOK,
+	}
+}
+
+// Readiness checks all the dependencies concurrently and reports whether the application can serve traffic.
+func (p *Probe) Readiness(ctx context.Context) (Report, bool) {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+
+		defer cancel()
+	}
+
+	statuses := make([]DependencyStatus, len(p.dependencies))
+	wg := new(sync.WaitGroup)
+
+	for i, dep := range p.dependencies {
+		wg.Add(1)
+
+		go func(i int, dep dependency) {
+			defer wg.Done()
+
+			statuses[i] = runCheck(ctx, dep)
+		}(i, dep)
+	}
+
+	wg.Wait()
+
+	if p.draining.Load() {
+		statuses = append(statuses, DependencyStatus{
+			Name:    shutdownDependency,
+			Status:  StatusFail,
+			Latency: time.Duration(0).String(),
+			Error:   errDraining.Error(),
+		})
+	}
+
+	report := Report{
+		Status:       StatusOK,
+		Dependencies: statuses,
+	}
+
+	for _, status := range statuses {
+		if status.Status != StatusOK {
+			report.Status = StatusFail
+
+			return report, false
+		}
+	}
+
+	return report, true
+}
+
+// runCheck runs the dependency check and measures its latency.
+func runCheck(ctx context.Context, dep dependency) DependencyStatus {
+	start := time.Now()
+	err := dep.check(ctx)
+
+	status := DependencyStatus{
+		Name:    dep.name,
+		Status:  StatusOK,
+		Latency: time.Since(start).String(),
+	}
+
+	if err != nil {
+		status.Status = StatusFail
+		status.Error = err.Error()
+	}
+
+	return status
+}
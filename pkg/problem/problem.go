@@ -0,0 +1,64 @@
+// Package problem writes RFC 7807 problem details error responses.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+)
+
+// ContentType is the media type of the problem details.
+const ContentType = "application/problem+json"
+
+// defaultType is the problem type meaning the problem has no more semantics than the status.
+const defaultType = "about:blank"
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	// The URI identifying the problem type.
+	Type string `json:"type"`
+	// The short summary of the problem type.
+	Title string `json:"title"`
+	// The HTTP status.
+	Status int `json:"status"`
+	// The explanation specific to the occurrence.
+	Detail string `json:"detail,omitempty"`
+	// The URI of the request the problem occurred at.
+	Instance string `json:"instance,omitempty"`
+	// The ID of the request the problem occurred at.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// New creates the problem of the request with the status and the detail.
+func New(req *http.Request, status int, detail string) *Problem {
+	return &Problem{
+		Type:      defaultType,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  req.URL.Path,
+		RequestID: requestctx.RequestID(req.Context()),
+	}
+}
+
+// Write writes the problem of the request with the status and the detail to the response.
+func Write(w http.ResponseWriter, req *http.Request, status int, detail string) {
+	New(req, status, detail).Write(w)
+}
+
+// Write writes the problem to the response.
+func (p *Problem) Write(w http.ResponseWriter) {
+	encData, err := json.Marshal(p)
+	if err != nil {
+		w.WriteHeader(p.Status)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+
+	_, _ = w.Write(encData)
+}
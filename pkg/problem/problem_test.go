@@ -0,0 +1,91 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+)
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/market/1?x=1", nil)
+	req = req.WithContext(requestctx.WithRequestID(req.Context(), "abc-123"))
+
+	recorder := httptest.NewRecorder()
+	Write(recorder, req, http.StatusServiceUnavailable, "the market is unavailable")
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	if got := recorder.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+
+	if got := recorder.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+
+	var got Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding the body %q: %v", recorder.Body.String(), err)
+	}
+
+	want := Problem{
+		Type:      "about:blank",
+		Title:     "Service Unavailable",
+		Status:    http.StatusServiceUnavailable,
+		Detail:    "the market is unavailable",
+		Instance:  "/v1/market/1",
+		RequestID: "abc-123",
+	}
+
+	if got != want {
+		t.Errorf("problem = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteOmitsEmptyMembers(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Write(recorder, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusNotFound, "")
+
+	var members map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &members); err != nil {
+		t.Fatalf("decoding the body %q: %v", recorder.Body.String(), err)
+	}
+
+	for _, name := range []string{"detail", "requestId"} {
+		if _, ok := members[name]; ok {
+			t.Errorf("the body %s has the empty %s member", recorder.Body.String(), name)
+		}
+	}
+
+	for _, name := range []string{"type", "title", "status", "instance"} {
+		if _, ok := members[name]; !ok {
+			t.Errorf("the body %s has no %s member", recorder.Body.String(), name)
+		}
+	}
+}
+
+func TestNewTitle(t *testing.T) {
+	tests := map[int]string{
+		http.StatusBadRequest:          "Bad Request",
+		http.StatusUnauthorized:        "Unauthorized",
+		http.StatusNotFound:            "Not Found",
+		http.StatusTooManyRequests:     "Too Many Requests",
+		http.StatusInternalServerError: "Internal Server Error",
+		http.StatusBadGateway:          "Bad Gateway",
+		http.StatusGatewayTimeout:      "Gateway Timeout",
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for status, want := range tests {
+		got := New(req, status, "")
+		if got.Title != want || got.Status != status {
+			t.Errorf("New(%d) title, status = %q, %d, want %q, %d", status, got.Title, got.Status, want, status)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package proxy provides a generic reverse proxy for config-driven routes.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+	"github.com/UArt-project/UArt-proxy/pkg/tracing"
+	"github.com/UArt-project/UArt-proxy/pkg/upstream"
+)
+
+var (
+	errEmptyPrefix   = errors.New("the route prefix is empty")
+	errEmptyUpstream = errors.New("the route upstream is empty")
+	errUpstreamURL   = errors.New("the route upstream must be an absolute url with a scheme and a host")
+)
+
+// originalPathKey is the context key of the request path before the Director rewrote it.
+type originalPathKey struct{}
+
+// Route maps a path prefix to an upstream.
+type Route struct {
+	// Prefix is the path prefix served by the route.
+	Prefix string `mapstructure:"prefix"`
+	// Methods are the allowed HTTP methods; all methods are allowed if empty.
+	Methods []string `mapstructure:"methods"`
+	// Upstream is the base url of the upstream.
+	Upstream string `mapstructure:"upstream"`
+	// StripPrefix is removed from the request path before proxying.
+	StripPrefix string `mapstructure:"stripPrefix"`
+	// AddPrefix is prepended to the request path before proxying.
+	AddPrefix string `mapstructure:"addPrefix"`
+	// Timeout is the deadline of the proxied request, none if zero.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// TLS configures the connections to an https upstream.
+	TLS upstream.TLSConfig `mapstructure:"tls"`
+}
+
+// NewHandler creates a reverse proxy handler for the route sending the requests with the transport.
+func NewHandler(route Route, transport http.RoundTripper, loggr *logger.Logger) (http.Handler, error) {
+	if route.Prefix == "" {
+		return nil, errEmptyPrefix
+	}
+
+	if route.Upstream == "" {
+		return nil, fmt.Errorf("route %s: %w", route.Prefix, errEmptyUpstream)
+	}
+
+	target, err := url.Parse(route.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the upstream url of route %s: %w", route.Prefix, err)
+	}
+
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("route %s: %w: %q", route.Prefix, errUpstreamURL, route.Upstream)
+	}
+
+	reverseProxy := &httputil.ReverseProxy{
+		Transport: timingTransport{next: transport},
+		Director: func(req *http.Request) {
+			rewritePath(req, route)
+
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = joinPath(target.Path, req.URL.Path)
+			req.URL.RawPath = ""
+			req.URL.RawQuery = joinQuery(target.RawQuery, req.URL.RawQuery)
+			req.Host = target.Host
+
+			if _, ok := req.Header["User-Agent"]; !ok {
+				req.Header.Set("User-Agent", "")
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			loggr.WithContext(req.Context()).Error("proxying %s %s to %s: %v", req.Method, req.URL.Path,
+				route.Upstream, err)
+
+			if errors.Is(err, context.DeadlineExceeded) {
+				writeProblem(w, req, http.StatusGatewayTimeout, "the upstream service didn't respond in time")
+
+				return
+			}
+
+			writeProblem(w, req, http.StatusBadGateway, "the upstream service couldn't be reached")
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), originalPathKey{}, req.URL.Path)
+
+		reverseProxy.ServeHTTP(w, req.WithContext(ctx))
+	}), nil
+}
+
+// writeProblem writes the problem of the proxied request, its instance is the path the client requested
+// rather than the rewritten upstream path.
+func writeProblem(w http.ResponseWriter, req *http.Request, status int, detail string) {
+	proxyProblem := problem.New(req, status, detail)
+
+	if path, ok := req.Context().Value(originalPathKey{}).(string); ok {
+		proxyProblem.Instance = path
+	}
+
+	proxyProblem.Write(w)
+}
+
+// timingTransport records the latency of the proxied requests in the request stats.
+type timingTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip sends the request to the upstream.
+func (t timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.Start(req.Context(), "proxy "+req.Method, tracing.KindClient)
+	defer span.End()
+
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", tracing.URL(req.URL))
+
+	req = req.Clone(ctx)
+	tracing.Inject(ctx, req.Header)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	requestctx.AddUpstreamLatency(ctx, time.Since(start))
+
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttribute("http.status_code", resp.StatusCode)
+	}
+
+	return resp, err //nolint:wrapcheck
+}
+
+// rewritePath applies the strip and add prefix options of the route to the request path.
+func rewritePath(req *http.Request, route Route) {
+	path := req.URL.Path
+
+	if route.StripPrefix != "" {
+		path = strings.TrimPrefix(path, route.StripPrefix)
+	}
+
+	if route.AddPrefix != "" {
+		path = joinPath(route.AddPrefix, path)
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	req.URL.Path = path
+}
+
+// joinQuery joins the query of the upstream url and the query of the request, like httputil.NewSingleHostReverseProxy.
+func joinQuery(targetQuery, query string) string {
+	if targetQuery == "" || query == "" {
+		return targetQuery + query
+	}
+
+	return targetQuery + "&" + query
+}
+
+// joinPath joins two url paths with a single slash between them.
+func joinPath(base, path string) string {
+	switch {
+	case base == "":
+		return path
+	case path == "":
+		return base
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
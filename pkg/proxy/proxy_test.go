@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+	"github.com/UArt-project/UArt-proxy/pkg/problem"
+)
+
+// newEchoServer starts an upstream writing the path and the query of the requests it gets.
+func newEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path+"?"+r.URL.RawQuery)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newTestHandler creates the handler of the route.
+func newTestHandler(t *testing.T, route Route) http.Handler {
+	t.Helper()
+
+	handler, err := NewHandler(route, http.DefaultTransport, logger.NewLogger(io.Discard, "test"))
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+
+	return handler
+}
+
+func TestRewriting(t *testing.T) {
+	server := newEchoServer(t)
+
+	tests := []struct {
+		name     string
+		route    Route
+		target   string
+		wantEcho string
+	}{
+		{
+			name:     "path kept",
+			route:    Route{Prefix: "/static", Upstream: server.URL},
+			target:   "/static/app.js",
+			wantEcho: "/static/app.js?",
+		},
+		{
+			name:     "prefix stripped",
+			route:    Route{Prefix: "/static", Upstream: server.URL, StripPrefix: "/static"},
+			target:   "/static/app.js",
+			wantEcho: "/app.js?",
+		},
+		{
+			name:     "whole path stripped",
+			route:    Route{Prefix: "/static", Upstream: server.URL, StripPrefix: "/static"},
+			target:   "/static",
+			wantEcho: "/?",
+		},
+		{
+			name:     "prefix added",
+			route:    Route{Prefix: "/static", Upstream: server.URL, AddPrefix: "/assets/"},
+			target:   "/static/app.js",
+			wantEcho: "/assets/static/app.js?",
+		},
+		{
+			name:     "prefix stripped and added under the upstream path",
+			route:    Route{Prefix: "/static", Upstream: server.URL + "/cdn/", StripPrefix: "/static", AddPrefix: "/v2"},
+			target:   "/static/app.js",
+			wantEcho: "/cdn/v2/app.js?",
+		},
+		{
+			name:     "request query",
+			route:    Route{Prefix: "/search", Upstream: server.URL},
+			target:   "/search?q=poster&page=2",
+			wantEcho: "/search?q=poster&page=2",
+		},
+		{
+			name:     "upstream query",
+			route:    Route{Prefix: "/search", Upstream: server.URL + "/?lang=uk"},
+			target:   "/search",
+			wantEcho: "/search?lang=uk",
+		},
+		{
+			name:     "both queries joined",
+			route:    Route{Prefix: "/search", Upstream: server.URL + "/?lang=uk"},
+			target:   "/search?q=poster",
+			wantEcho: "/search?lang=uk&q=poster",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			newTestHandler(t, tt.route).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+			}
+
+			if got := recorder.Body.String(); got != tt.wantEcho {
+				t.Errorf("upstream request = %q, want %q", got, tt.wantEcho)
+			}
+		})
+	}
+}
+
+func TestUnreachableUpstream(t *testing.T) {
+	server := newEchoServer(t)
+	server.Close()
+
+	handler := newTestHandler(t, Route{Prefix: "/static", Upstream: server.URL, StripPrefix: "/static"})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusBadGateway)
+	}
+
+	if got := recorder.Header().Get("Content-Type"); got != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, problem.ContentType)
+	}
+
+	var body problem.Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding the problem: %v", err)
+	}
+
+	// The instance is the path the client requested, not the rewritten one.
+	if body.Status != http.StatusBadGateway || body.Instance != "/static/app.js" {
+		t.Errorf("problem = %+v, want a 502 of /static/app.js", body)
+	}
+}
+
+func TestNewHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   Route
+		wantErr error
+	}{
+		{name: "empty prefix", route: Route{Upstream: "http://files"}, wantErr: errEmptyPrefix},
+		{name: "empty upstream", route: Route{Prefix: "/static"}, wantErr: errEmptyUpstream},
+		{name: "relative upstream", route: Route{Prefix: "/static", Upstream: "files/static"}, wantErr: errUpstreamURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHandler(tt.route, http.DefaultTransport, logger.NewLogger(io.Discard, "test"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewHandler() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Package ratelimit provides token bucket rate limiting of the clients.
+package ratelimit
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/clientip"
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+)
+
+// Kinds of the keys identifying the clients.
+const (
+	// KeyIP identifies the clients by the IP address.
+	KeyIP = "ip"
+	// KeyUser identifies the clients by the identifier of the user stored in the request context.
+	KeyUser = "user"
+	// KeyAPIKey identifies the clients by the API key header.
+	KeyAPIKey = "apiKey"
+)
+
+const (
+	// DefaultRoute is the route of the rule applied to the routes without their own rule.
+	DefaultRoute = "*"
+
+	apiKeyHeader       = "X-API-Key"
+	defaultIdleTimeout = 10 * time.Minute
+
+	// maxBuckets bounds the number of buckets, the least recently used bucket is evicted for a new client beyond it.
+	maxBuckets = 100000
+	// credentialHashLength is the number of hex digits of the credential hashes kept in the keys.
+	credentialHashLength = 16
+)
+
+// Rule is the rate limit of a route.
+type Rule struct {
+	// Route is the name of the route, DefaultRoute applies to the routes without their own rule.
+	Route string `mapstructure:"route"`
+	// Key is the kind of the key identifying the clients, the IP address is used if the key is missing.
+	Key string `mapstructure:"key"`
+	// Rate is the number of requests per second refilled into the bucket.
+	Rate float64 `mapstructure:"rate"`
+	// Burst is the size of the bucket.
+	Burst int `mapstructure:"burst"`
+}
+
+// Result is the outcome of a rate limited request.
+type Result struct {
+	// Whether the request is allowed.
+	Allowed bool
+	// The size of the bucket.
+	Limit int
+	// The number of requests left in the bucket.
+	Remaining int
+	// The time until the bucket is full again.
+	Reset time.Duration
+	// The time until the next request is allowed, zero if allowed.
+	RetryAfter time.Duration
+}
+
+// bucket is the token bucket of a client.
+type bucket struct {
+	key      string
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limiter limits the rate of the requests of every client with a token bucket.
+type Limiter struct {
+	mu    *sync.Mutex
+	rules map[string]Rule
+	// The buckets by key, the elements of the recency list.
+	buckets map[string]*list.Element
+	// The buckets from the most to the least recently used.
+	recency     *list.List
+	maxBuckets  int
+	idleTimeout time.Duration
+	resolver    *clientip.Resolver
+	stop        chan struct{}
+	wg          *sync.WaitGroup
+}
+
+// NewLimiter creates a new instance of the Limiter and starts evicting the buckets idle for the idle timeout.
+// The IP addresses of the clients are resolved with the resolver.
+func NewLimiter(rules []Rule, idleTimeout time.Duration, resolver *clientip.Resolver) *Limiter {
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+
+	limiter := &Limiter{
+		mu:          new(sync.Mutex),
+		rules:       make(map[string]Rule),
+		buckets:     make(map[string]*list.Element),
+		recency:     list.New(),
+		maxBuckets:  maxBuckets,
+		idleTimeout: idleTimeout,
+		resolver:    resolver,
+		stop:        make(chan struct{}),
+		wg:          new(sync.WaitGroup),
+	}
+
+	limiter.SetRules(rules)
+
+	limiter.wg.Add(1)
+
+	go func() {
+		defer limiter.wg.Done()
+
+		limiter.evictLoop()
+	}()
+
+	return limiter
+}
+
+// SetRules replaces the rules, the rules without a positive rate and burst are ignored.
+// The buckets of the clients are kept, a lowered burst applies on their next request.
+func (l *Limiter) SetRules(rules []Rule) {
+	ruleMap := make(map[string]Rule, len(rules))
+
+	for _, rule := range rules {
+		if rule.Rate > 0 && rule.Burst > 0 {
+			ruleMap[rule.Route] = rule
+		}
+	}
+
+	l.mu.Lock()
+	l.rules = ruleMap
+	l.mu.Unlock()
+}
+
+// Rule returns the rule of the route, falling back to the default rule.
+func (l *Limiter) Rule(route string) (Rule, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rule, ok := l.rules[route]
+	if !ok {
+		rule, ok = l.rules[DefaultRoute]
+	}
+
+	return rule, ok
+}
+
+// Allow takes a token from the bucket of the client under the rule.
+func (l *Limiter) Allow(rule Rule, client string) Result {
+	return l.allow(rule, client, time.Now())
+}
+
+// allow takes a token from the bucket of the client under the rule at the time.
+// A new client beyond the bucket limit evicts the least recently used bucket, which is a full bucket
+// again on the next request of its client, so made-up clients can't get the other clients rejected.
+func (l *Limiter) allow(rule Rule, client string, now time.Time) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := rule.Route + "|" + client
+
+	var clientBucket *bucket
+
+	if element, ok := l.buckets[key]; ok {
+		clientBucket, _ = element.Value.(*bucket)
+		l.recency.MoveToFront(element)
+	} else {
+		if l.recency.Len() >= l.maxBuckets {
+			l.remove(l.recency.Back())
+		}
+
+		clientBucket = &bucket{
+			key:      key,
+			tokens:   float64(rule.Burst),
+			lastSeen: now,
+		}
+		l.buckets[key] = l.recency.PushFront(clientBucket)
+	}
+
+	clientBucket.tokens = math.Min(float64(rule.Burst),
+		clientBucket.tokens+now.Sub(clientBucket.lastSeen).Seconds()*rule.Rate)
+	clientBucket.lastSeen = now
+
+	result := Result{
+		Allowed: clientBucket.tokens >= 1,
+		Limit:   rule.Burst,
+	}
+
+	if result.Allowed {
+		clientBucket.tokens--
+	} else {
+		result.RetryAfter = secondsToDuration((1 - clientBucket.tokens) / rule.Rate)
+	}
+
+	result.Remaining = int(clientBucket.tokens)
+	result.Reset = secondsToDuration((float64(rule.Burst) - clientBucket.tokens) / rule.Rate)
+
+	return result
+}
+
+// ClientKey returns the key identifying the client of the request under the rule.
+// The credentials aren't verified here, so the user and the API key are combined with the IP address:
+// a client making up credentials gets a bucket per made-up value but can't drain the bucket of another client.
+func (l *Limiter) ClientKey(req *http.Request, rule Rule) string {
+	ip := l.resolver.IP(req)
+
+	switch rule.Key {
+	case KeyUser:
+		if user := requestctx.User(req.Context()); user != "" {
+			return KeyUser + ":" + user + "@" + ip
+		}
+	case KeyAPIKey:
+		if apiKey := req.Header.Get(apiKeyHeader); apiKey != "" {
+			return KeyAPIKey + ":" + hashCredential(apiKey) + "@" + ip
+		}
+	}
+
+	return KeyIP + ":" + ip
+}
+
+// Stop shuts the eviction of the idle buckets down.
+func (l *Limiter) Stop() {
+	close(l.stop)
+
+	l.wg.Wait()
+}
+
+// evictLoop periodically removes the buckets idle for the idle timeout.
+func (l *Limiter) evictLoop() {
+	ticker := time.NewTicker(l.idleTimeout)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.evictIdle(time.Now())
+		}
+	}
+}
+
+// evictIdle removes the buckets idle for the idle timeout at the time.
+func (l *Limiter) evictIdle(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for element := l.recency.Back(); element != nil; element = l.recency.Back() {
+		clientBucket, _ := element.Value.(*bucket)
+		if now.Sub(clientBucket.lastSeen) < l.idleTimeout {
+			return
+		}
+
+		l.remove(element)
+	}
+}
+
+// remove drops the bucket of the recency list element, the caller must hold the lock.
+func (l *Limiter) remove(element *list.Element) {
+	clientBucket, _ := element.Value.(*bucket)
+
+	l.recency.Remove(element)
+	delete(l.buckets, clientBucket.key)
+}
+
+// hashCredential returns a short hash of the credential, so the keys neither hold it nor grow with it.
+func hashCredential(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+
+	return hex.EncodeToString(sum[:])[:credentialHashLength]
+}
+
+// secondsToDuration converts the fractional seconds to a duration.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,218 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+)
+
+// newTestLimiter creates a limiter with the rules, stopped at the end of the test.
+func newTestLimiter(t *testing.T, idleTimeout time.Duration, rules ...Rule) *Limiter {
+	t.Helper()
+
+	limiter := NewLimiter(rules, idleTimeout, nil)
+	t.Cleanup(limiter.Stop)
+
+	return limiter
+}
+
+func TestAllowRefill(t *testing.T) {
+	rule := Rule{Route: "market", Rate: 2, Burst: 2}
+	limiter := newTestLimiter(t, time.Hour, rule)
+	start := time.Now()
+
+	steps := []struct {
+		after          time.Duration
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+	}{
+		{after: 0, wantAllowed: true, wantRemaining: 1},
+		{after: 0, wantAllowed: true, wantRemaining: 0},
+		{after: 0, wantAllowed: false, wantRemaining: 0, wantRetryAfter: 500 * time.Millisecond},
+		{after: 250 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantRetryAfter: 250 * time.Millisecond},
+		{after: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+		{after: 10 * time.Second, wantAllowed: true, wantRemaining: 1},
+	}
+
+	for i, step := range steps {
+		result := limiter.allow(rule, "ip:203.0.113.7", start.Add(step.after))
+
+		if result.Allowed != step.wantAllowed || result.Remaining != step.wantRemaining {
+			t.Fatalf("step %d: allowed, remaining = %t, %d, want %t, %d",
+				i, result.Allowed, result.Remaining, step.wantAllowed, step.wantRemaining)
+		}
+
+		if result.RetryAfter != step.wantRetryAfter {
+			t.Errorf("step %d: RetryAfter = %s, want %s", i, result.RetryAfter, step.wantRetryAfter)
+		}
+
+		if result.Limit != rule.Burst {
+			t.Errorf("step %d: Limit = %d, want %d", i, result.Limit, rule.Burst)
+		}
+	}
+}
+
+func TestAllowSeparatesClientsAndRoutes(t *testing.T) {
+	market := Rule{Route: "market", Rate: 1, Burst: 1}
+	auth := Rule{Route: "auth", Rate: 1, Burst: 1}
+	limiter := newTestLimiter(t, time.Hour, market, auth)
+	now := time.Now()
+
+	if !limiter.allow(market, "ip:a", now).Allowed {
+		t.Fatal("the first request was rejected")
+	}
+
+	if limiter.allow(market, "ip:a", now).Allowed {
+		t.Error("the request beyond the burst was allowed")
+	}
+
+	if !limiter.allow(market, "ip:b", now).Allowed {
+		t.Error("another client was rejected")
+	}
+
+	if !limiter.allow(auth, "ip:a", now).Allowed {
+		t.Error("the client was rejected on another route")
+	}
+}
+
+func TestAllowEvictsTheLeastRecentlyUsedBucket(t *testing.T) {
+	rule := Rule{Route: "market", Rate: 1, Burst: 1}
+	limiter := newTestLimiter(t, time.Hour, rule)
+	limiter.maxBuckets = 2
+	now := time.Now()
+
+	limiter.allow(rule, "ip:a", now)
+	limiter.allow(rule, "ip:b", now)
+	// The bucket of a is used again, b is the least recently used.
+	limiter.allow(rule, "ip:a", now)
+
+	// A new client beyond the limit gets its own bucket instead of a rejection.
+	if !limiter.allow(rule, "ip:c", now).Allowed {
+		t.Fatal("the new client beyond the bucket limit was rejected")
+	}
+
+	if len(limiter.buckets) != 2 || limiter.recency.Len() != 2 {
+		t.Fatalf("%d buckets, %d in the recency list, want 2", len(limiter.buckets), limiter.recency.Len())
+	}
+
+	for key, want := range map[string]bool{"market|ip:a": true, "market|ip:b": false, "market|ip:c": true} {
+		if _, ok := limiter.buckets[key]; ok != want {
+			t.Errorf("bucket %s kept = %t, want %t", key, ok, want)
+		}
+	}
+}
+
+func TestEvictIdle(t *testing.T) {
+	rule := Rule{Route: "market", Rate: 1, Burst: 1}
+	limiter := newTestLimiter(t, time.Minute, rule)
+	start := time.Now()
+
+	limiter.allow(rule, "ip:a", start)
+	limiter.allow(rule, "ip:b", start.Add(30*time.Second))
+
+	limiter.evictIdle(start.Add(59 * time.Second))
+
+	if len(limiter.buckets) != 2 {
+		t.Fatalf("%d buckets before the idle timeout, want 2", len(limiter.buckets))
+	}
+
+	limiter.evictIdle(start.Add(61 * time.Second))
+
+	if _, ok := limiter.buckets["market|ip:b"]; !ok || len(limiter.buckets) != 1 || limiter.recency.Len() != 1 {
+		t.Errorf("buckets = %v, want only the bucket of b", limiter.buckets)
+	}
+
+	// The evicted client starts with a full bucket.
+	if result := limiter.allow(rule, "ip:a", start.Add(61*time.Second)); !result.Allowed {
+		t.Error("the evicted client was rejected")
+	}
+}
+
+func TestRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     []Rule
+		route     string
+		wantRoute string
+		wantOK    bool
+	}{
+		{
+			name:      "route rule",
+			rules:     []Rule{{Route: "market", Rate: 1, Burst: 1}, {Route: DefaultRoute, Rate: 5, Burst: 5}},
+			route:     "market",
+			wantRoute: "market",
+			wantOK:    true,
+		},
+		{
+			name:      "default rule fallback",
+			rules:     []Rule{{Route: "market", Rate: 1, Burst: 1}, {Route: DefaultRoute, Rate: 5, Burst: 5}},
+			route:     "auth",
+			wantRoute: DefaultRoute,
+			wantOK:    true,
+		},
+		{name: "no rule", rules: []Rule{{Route: "market", Rate: 1, Burst: 1}}, route: "auth"},
+		{name: "rule without a rate ignored", rules: []Rule{{Route: "market", Burst: 1}}, route: "market"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newTestLimiter(t, time.Hour, tt.rules...)
+
+			rule, ok := limiter.Rule(tt.route)
+			if ok != tt.wantOK || rule.Route != tt.wantRoute {
+				t.Errorf("Rule() = %+v, %t, want the rule of %q, %t", rule, ok, tt.wantRoute, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		user   string
+		apiKey string
+		want   string
+	}{
+		{name: "ip", key: KeyIP, user: "alice", apiKey: "secret", want: "ip:203.0.113.7"},
+		{name: "missing key kind", want: "ip:203.0.113.7"},
+		{name: "user", key: KeyUser, user: "alice", want: "user:alice@203.0.113.7"},
+		{name: "user missing", key: KeyUser, want: "ip:203.0.113.7"},
+		{
+			name:   "api key hashed",
+			key:    KeyAPIKey,
+			apiKey: "secret",
+			want:   "apiKey:" + hashCredential("secret") + "@203.0.113.7",
+		},
+		{name: "api key missing", key: KeyAPIKey, want: "ip:203.0.113.7"},
+	}
+
+	limiter := newTestLimiter(t, time.Hour)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "203.0.113.7:4321"
+
+			if tt.user != "" {
+				req = req.WithContext(requestctx.WithUser(req.Context(), tt.user))
+			}
+
+			if tt.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tt.apiKey)
+			}
+
+			if got := limiter.ClientKey(req, Rule{Key: tt.key}); got != tt.want {
+				t.Errorf("ClientKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if len(hashCredential("secret")) != credentialHashLength {
+		t.Errorf("the credential hash has %d digits, want %d", len(hashCredential("secret")), credentialHashLength)
+	}
+}
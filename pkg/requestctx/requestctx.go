@@ -0,0 +1,102 @@
+// Package requestctx carries request-scoped values through the context.
+package requestctx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache statuses of a request.
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// contextKey is the type of the context keys of the package.
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userKey
+	statsKey
+)
+
+// WithRequestID returns a copy of the context carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the request ID carried by the context.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+
+	return requestID
+}
+
+// WithUser returns a copy of the context carrying the identifier of the user, never the credentials themselves.
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// User returns the identifier of the user carried by the context.
+func User(ctx context.Context) string {
+	user, _ := ctx.Value(userKey).(string)
+
+	return user
+}
+
+// Stats collects what happened while handling a request, for the access log.
+type Stats struct {
+	mu              sync.Mutex
+	upstreamLatency time.Duration
+	cacheStatus     string
+}
+
+// WithStats returns a copy of the context carrying new request stats.
+func WithStats(ctx context.Context) (context.Context, *Stats) {
+	stats := new(Stats)
+
+	return context.WithValue(ctx, statsKey, stats), stats
+}
+
+// StatsFrom returns the request stats carried by the context.
+func StatsFrom(ctx context.Context) (*Stats, bool) {
+	stats, ok := ctx.Value(statsKey).(*Stats)
+
+	return stats, ok
+}
+
+// AddUpstreamLatency adds the duration of an upstream call to the request stats carried by the context.
+func AddUpstreamLatency(ctx context.Context, latency time.Duration) {
+	if stats, ok := ctx.Value(statsKey).(*Stats); ok {
+		stats.mu.Lock()
+		stats.upstreamLatency += latency
+		stats.mu.Unlock()
+	}
+}
+
+// SetCacheStatus records whether the response was served from the cache in the request stats carried by the context.
+func SetCacheStatus(ctx context.Context, status string) {
+	if stats, ok := ctx.Value(statsKey).(*Stats); ok {
+		stats.mu.Lock()
+		stats.cacheStatus = status
+		stats.mu.Unlock()
+	}
+}
+
+// UpstreamLatency returns the total duration of the upstream calls.
+func (s *Stats) UpstreamLatency() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.upstreamLatency
+}
+
+// CacheStatus returns whether the response was served from the cache, empty if the cache wasn't used.
+func (s *Stats) CacheStatus() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cacheStatus
+}
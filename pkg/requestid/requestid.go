@@ -0,0 +1,62 @@
+// Package requestid is used for assigning an ID to every request.
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+)
+
+// Header is the header carrying the request ID.
+const Header = "X-Request-ID"
+
+const (
+	idBytes     = 16
+	maxIDLength = 128
+)
+
+// Middleware accepts the request ID of the incoming request or generates a new one,
+// stores it in the request context and the request headers, and echoes it in the response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(Header)
+		if !valid(requestID) {
+			requestID = generate()
+		}
+
+		req.Header.Set(Header, requestID)
+		w.Header().Set(Header, requestID)
+
+		next.ServeHTTP(w, req.WithContext(requestctx.WithRequestID(req.Context(), requestID)))
+	})
+}
+
+// generate returns a new random request ID.
+func generate() string {
+	buf := make([]byte, idBytes)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// valid reports whether the incoming request ID is safe to log and forward.
+func valid(requestID string) bool {
+	if requestID == "" || len(requestID) > maxIDLength {
+		return false
+	}
+
+	for _, char := range requestID {
+		isAlnum := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+		if !isAlnum && char != '-' && char != '_' && char != '.' && char != ':' {
+			return false
+		}
+	}
+
+	return true
+}
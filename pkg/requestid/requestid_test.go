@@ -0,0 +1,76 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+)
+
+// generatedID matches the IDs generated by the middleware.
+var generatedID = regexp.MustCompile(`^[0-9a-f]{32}$`) //nolint:gochecknoglobals
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		incoming     string
+		wantIncoming bool
+	}{
+		{name: "no incoming ID"},
+		{name: "valid incoming ID", incoming: "client-42_a.b:c", wantIncoming: true},
+		{name: "UUID", incoming: "123e4567-e89b-12d3-a456-426614174000", wantIncoming: true},
+		{name: "header injection", incoming: "abc\r\nX-Admin: 1"},
+		{name: "spaces", incoming: "abc def"},
+		{name: "too long", incoming: strings.Repeat("a", maxIDLength+1)},
+		{name: "longest accepted", incoming: strings.Repeat("a", maxIDLength), wantIncoming: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contextID, forwardedID string
+
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				contextID = requestctx.RequestID(req.Context())
+				forwardedID = req.Header.Get(Header)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(Header, tt.incoming)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			responseID := recorder.Header().Get(Header)
+
+			if tt.wantIncoming && responseID != tt.incoming {
+				t.Errorf("response ID = %q, want the incoming %q", responseID, tt.incoming)
+			}
+
+			if !tt.wantIncoming && !generatedID.MatchString(responseID) {
+				t.Errorf("response ID = %q, want a generated one", responseID)
+			}
+
+			if contextID != responseID || forwardedID != responseID {
+				t.Errorf("context ID, forwarded ID = %q, %q, want the response ID %q", contextID, forwardedID, responseID)
+			}
+		})
+	}
+}
+
+func TestGeneratedIDsAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+
+	for i := 0; i < 100; i++ {
+		requestID := generate()
+		if seen[requestID] {
+			t.Fatalf("generate() returned %q twice", requestID)
+		}
+
+		seen[requestID] = true
+	}
+}
@@ -0,0 +1,123 @@
+// Package retry provides retry policies with exponential backoff and jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultBackoffBase = 100 * time.Millisecond
+	defaultBackoffCap  = 2 * time.Second
+)
+
+// ErrBudgetExceeded is returned when the backoff wouldn't end before the deadline of the context.
+var ErrBudgetExceeded = errors.New("the retry backoff exceeds the request deadline")
+
+// Policy consists of the retry options.
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts including the first one, retries are disabled if below 2.
+	MaxAttempts int `mapstructure:"maxAttempts"`
+	// BackoffBase is the backoff before the first retry, doubled for every next one.
+	BackoffBase time.Duration `mapstructure:"backoffBase"`
+	// BackoffCap is the maximum backoff.
+	BackoffCap time.Duration `mapstructure:"backoffCap"`
+	// Jitter is the fraction of the backoff randomly taken off, from 0 to 1.
+	Jitter float64 `mapstructure:"jitter"`
+	// RetryableStatusCodes are the response statuses worth retrying.
+	RetryableStatusCodes []int `mapstructure:"retryableStatusCodes"`
+	// RetryNetworkErrors enables retrying failed connections.
+	RetryNetworkErrors bool `mapstructure:"retryNetworkErrors"`
+}
+
+// Enabled reports whether the policy allows retries.
+func (p Policy) Enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// Idempotent reports whether a request with the method is safe to retry.
+func Idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryableStatus reports whether a response with the status is worth retrying.
+func (p Policy) RetryableStatus(status int) bool {
+	for _, code := range p.RetryableStatusCodes {
+		if code == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RetryableError reports whether a failed request is worth retrying.
+// Errors caused by the cancellation or the deadline of the context are never retried.
+func (p Policy) RetryableError(ctx context.Context, err error) bool {
+	if !p.RetryNetworkErrors || ctx.Err() != nil {
+		return false
+	}
+
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// Backoff returns the time to wait before the retry with the number, starting from 1.
+func (p Policy) Backoff(retry int) time.Duration {
+	base := p.BackoffBase
+	if base <= 0 {
+		base = defaultBackoffBase
+	}
+
+	backoffCap := p.BackoffCap
+	if backoffCap <= 0 {
+		backoffCap = defaultBackoffCap
+	}
+
+	backoff := base
+	for i := 1; i < retry && backoff < backoffCap; i++ {
+		backoff *= 2
+	}
+
+	if backoff > backoffCap {
+		backoff = backoffCap
+	}
+
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+
+		backoff -= time.Duration(rand.Float64() * jitter * float64(backoff)) //nolint:gosec
+	}
+
+	return backoff
+}
+
+// Wait sleeps for the backoff of the retry with the number unless the context is done first.
+// It returns ErrBudgetExceeded without sleeping if the backoff would end after the deadline of the context.
+func (p Policy) Wait(ctx context.Context, retry int) error {
+	backoff := p.Backoff(retry)
+
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+		return ErrBudgetExceeded
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,188 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		retry  int
+		want   time.Duration
+	}{
+		{name: "first retry waits the base", policy: Policy{BackoffBase: 10 * time.Millisecond, BackoffCap: time.Second},
+			retry: 1, want: 10 * time.Millisecond},
+		{name: "second retry doubles", policy: Policy{BackoffBase: 10 * time.Millisecond, BackoffCap: time.Second},
+			retry: 2, want: 20 * time.Millisecond},
+		{name: "fourth retry doubles thrice", policy: Policy{BackoffBase: 10 * time.Millisecond, BackoffCap: time.Second},
+			retry: 4, want: 80 * time.Millisecond},
+		{name: "capped", policy: Policy{BackoffBase: 10 * time.Millisecond, BackoffCap: 50 * time.Millisecond},
+			retry: 4, want: 50 * time.Millisecond},
+		{name: "far retry stays capped", policy: Policy{BackoffBase: 10 * time.Millisecond, BackoffCap: time.Second},
+			retry: 100, want: time.Second},
+		{name: "defaults", policy: Policy{}, retry: 1, want: defaultBackoffBase},
+		{name: "default cap", policy: Policy{}, retry: 100, want: defaultBackoffCap},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Backoff(tt.retry); got != tt.want {
+				t.Errorf("Backoff(%d) = %s, want %s", tt.retry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter float64
+		min    time.Duration
+	}{
+		{name: "half", jitter: 0.5, min: 50 * time.Millisecond},
+		{name: "above one is clamped", jitter: 3, min: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := Policy{BackoffBase: 100 * time.Millisecond, BackoffCap: time.Second, Jitter: tt.jitter}
+
+			for i := 0; i < 100; i++ {
+				if got := policy.Backoff(1); got < tt.min || got > 100*time.Millisecond {
+					t.Fatalf("Backoff(1) = %s, want between %s and %s", got, tt.min, 100*time.Millisecond)
+				}
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	policy := Policy{BackoffBase: 20 * time.Millisecond, BackoffCap: time.Second}
+
+	t.Run("waits the backoff", func(t *testing.T) {
+		start := time.Now()
+
+		if err := policy.Wait(context.Background(), 1); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("Wait() returned after %s, want at least %s", elapsed, 20*time.Millisecond)
+		}
+	})
+
+	t.Run("backoff past the deadline exceeds the budget", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+
+		if err := policy.Wait(ctx, 2); !errors.Is(err, ErrBudgetExceeded) {
+			t.Fatalf("Wait() error = %v, want %v", err, ErrBudgetExceeded)
+		}
+
+		if elapsed := time.Since(start); elapsed >= 20*time.Millisecond {
+			t.Errorf("Wait() returned after %s, want without sleeping", elapsed)
+		}
+	})
+
+	t.Run("backoff within the deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := policy.Wait(ctx, 1); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := policy.Wait(ctx, 1); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Wait() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestRetryableError(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	netErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		ctx    context.Context
+		err    error
+		want   bool
+	}{
+		{name: "network error", policy: Policy{RetryNetworkErrors: true}, ctx: context.Background(), err: netErr,
+			want: true},
+		{name: "network errors disabled", policy: Policy{}, ctx: context.Background(), err: netErr, want: false},
+		{name: "deadline exceeded", policy: Policy{RetryNetworkErrors: true}, ctx: context.Background(),
+			err: context.DeadlineExceeded, want: false},
+		{name: "canceled", policy: Policy{RetryNetworkErrors: true}, ctx: context.Background(), err: context.Canceled,
+			want: false},
+		{name: "context done", policy: Policy{RetryNetworkErrors: true}, ctx: canceled, err: netErr, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.RetryableError(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("RetryableError() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	policy := Policy{RetryableStatusCodes: []int{http.StatusBadGateway, http.StatusServiceUnavailable}}
+
+	tests := map[int]bool{
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusInternalServerError: false,
+		http.StatusOK:                  false,
+	}
+
+	for status, want := range tests {
+		if got := policy.RetryableStatus(status); got != want {
+			t.Errorf("RetryableStatus(%d) = %t, want %t", status, got, want)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	tests := map[string]bool{
+		http.MethodGet:    true,
+		http.MethodHead:   true,
+		http.MethodPut:    true,
+		http.MethodDelete: true,
+		http.MethodPost:   false,
+		http.MethodPatch:  false,
+	}
+
+	for method, want := range tests {
+		if got := Idempotent(method); got != want {
+			t.Errorf("Idempotent(%s) = %t, want %t", method, got, want)
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	tests := map[int]bool{0: false, 1: false, 2: true, 5: true}
+
+	for maxAttempts, want := range tests {
+		if got := (Policy{MaxAttempts: maxAttempts}).Enabled(); got != want {
+			t.Errorf("Enabled() with %d attempts = %t, want %t", maxAttempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package rotatefile provides a file writer rotating the file once it grows too big.
+package rotatefile
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	filePerm = 0o644
+	megabyte = 1 << 20
+)
+
+// File is a writer rotating the file once it reaches the maximum size.
+// The rotated files get the .1, .2, ... suffixes, the oldest ones are removed.
+type File struct {
+	mu         *sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// Open opens the file for appending, rotating it after maxSizeMB megabytes and keeping maxBackups rotated files.
+func Open(path string, maxSizeMB, maxBackups int) (*File, error) {
+	rotated := &File{
+		mu:         new(sync.Mutex),
+		path:       path,
+		maxSize:    int64(maxSizeMB) * megabyte,
+		maxBackups: maxBackups,
+	}
+
+	if err := rotated.open(); err != nil {
+		return nil, err
+	}
+
+	return rotated, nil
+}
+
+// Write writes the data to the file, rotating it first if the data doesn't fit.
+func (f *File) Write(data []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(data)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	written, err := f.file.Write(data)
+	f.size += int64(written)
+
+	if err != nil {
+		return written, fmt.Errorf("writing to %s: %w", f.path, err)
+	}
+
+	return written, nil
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", f.path, err)
+	}
+
+	return nil
+}
+
+// open opens the file for appending.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, filePerm)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", f.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("reading the size of %s: %w", f.path, err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+
+	return nil
+}
+
+// rotate shifts the rotated files, moves the current file to the .1 suffix and opens a new one.
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", f.path, err)
+	}
+
+	if f.maxBackups < 1 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s: %w", f.path, err)
+		}
+
+		return f.open()
+	}
+
+	_ = os.Remove(f.backup(f.maxBackups))
+
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(f.backup(i), f.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotating %s: %w", f.backup(i), err)
+		}
+	}
+
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return fmt.Errorf("rotating %s: %w", f.path, err)
+	}
+
+	return f.open()
+}
+
+// backup returns the path of the rotated file with the number.
+func (f *File) backup(number int) string {
+	return f.path + "." + strconv.Itoa(number)
+}
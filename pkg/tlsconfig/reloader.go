@@ -0,0 +1,147 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+)
+
+// CertReloader serves a certificate pair loaded from disk and reloads it when the files change.
+// The open connections keep the certificate they were established with.
+type CertReloader struct {
+	// The paths of the PEM encoded certificate chain and private key.
+	certFile string
+	keyFile  string
+	// The logger of the watch loop.
+	loggr *logger.Logger
+	// The certificate served to the new connections.
+	cert atomic.Pointer[tls.Certificate]
+	// The modification times of the loaded files.
+	certModTime time.Time
+	keyModTime  time.Time
+	// Guards the reloads and the modification times.
+	mu *sync.Mutex
+	// Stops the watch loop.
+	stop chan struct{}
+	// Waits for the watch loop to exit.
+	wg *sync.WaitGroup
+}
+
+// NewCertReloader creates a new instance of the CertReloader and loads the certificate pair.
+func NewCertReloader(certFile, keyFile string, loggr *logger.Logger) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		loggr:    loggr,
+		mu:       new(sync.Mutex),
+		stop:     make(chan struct{}),
+		wg:       new(sync.WaitGroup),
+	}
+
+	err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate, it is used as tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Reload loads the certificate pair from disk.
+// The current certificate is kept if the new pair is invalid.
+func (r *CertReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading the certificate pair: %w", err)
+	}
+
+	r.cert.Store(&cert)
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+
+	return nil
+}
+
+// Watch checks the files for changes on every interval and reloads the pair when they change.
+func (r *CertReloader) Watch(interval time.Duration) {
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(interval)
+
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+
+				if err := r.Reload(); err != nil {
+					r.loggr.Error("reloading the changed certificate: %v", err)
+
+					continue
+				}
+
+				r.loggr.Info("reloaded the changed certificate %s", r.certFile)
+			}
+		}
+	}()
+}
+
+// Stop stops watching the files.
+func (r *CertReloader) Stop() {
+	close(r.stop)
+
+	r.wg.Wait()
+}
+
+// changed reports whether the files were modified since the last load.
+func (r *CertReloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return false
+	}
+
+	return !certModTime.Equal(r.certModTime) || !keyModTime.Equal(r.keyModTime)
+}
+
+// modTimes returns the modification times of the certificate and the key files.
+func (r *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("reading the certificate file: %w", err)
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("reading the key file: %w", err)
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
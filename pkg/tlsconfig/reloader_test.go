@@ -0,0 +1,155 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+)
+
+// writeCertPair writes a self-signed certificate for the common name and its key to the files,
+// with the modification time, and returns the certificate.
+func writeCertPair(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating the key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating the certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("encoding the key: %v", err)
+	}
+
+	writePEM(t, certFile, "CERTIFICATE", der, modTime)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER, modTime)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing the certificate: %v", err)
+	}
+
+	return cert
+}
+
+// writePEM writes the PEM block to the file with the modification time.
+func writePEM(t *testing.T, path, blockType string, der []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("setting the modification time of %s: %v", path, err)
+	}
+}
+
+// servedCommonName returns the common name of the certificate served by the reloader.
+func servedCommonName(t *testing.T, reloader *CertReloader) string {
+	t.Helper()
+
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parsing the served certificate: %v", err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	start := time.Now().Add(-time.Minute)
+
+	writeCertPair(t, certFile, keyFile, "first", start)
+
+	reloader, err := NewCertReloader(certFile, keyFile, logger.NewLogger(io.Discard, "test"))
+	if err != nil {
+		t.Fatalf("NewCertReloader() error = %v", err)
+	}
+
+	reloader.Watch(5 * time.Millisecond)
+	defer reloader.Stop()
+
+	if got := servedCommonName(t, reloader); got != "first" {
+		t.Fatalf("served certificate = %s, want first", got)
+	}
+
+	writeCertPair(t, certFile, keyFile, "second", start.Add(time.Second))
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for servedCommonName(t, reloader) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the changed certificate to be served")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCertReloaderKeepsTheCertificateOnInvalidPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+
+	writeCertPair(t, certFile, keyFile, "first", time.Now())
+
+	reloader, err := NewCertReloader(certFile, keyFile, logger.NewLogger(io.Discard, "test"))
+	if err != nil {
+		t.Fatalf("NewCertReloader() error = %v", err)
+	}
+
+	// The key of another pair doesn't match the certificate.
+	otherKeyFile := filepath.Join(dir, "other.key")
+	writeCertPair(t, filepath.Join(dir, "other.crt"), otherKeyFile, "other", time.Now())
+
+	otherKey, err := os.ReadFile(otherKeyFile)
+	if err != nil {
+		t.Fatalf("reading the other key: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, otherKey, 0o600); err != nil {
+		t.Fatalf("writing the key: %v", err)
+	}
+
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("Reload() of a mismatched pair succeeded")
+	}
+
+	if got := servedCommonName(t, reloader); got != "first" {
+		t.Errorf("served certificate = %s, want first", got)
+	}
+
+	if _, err := NewCertReloader(certFile, filepath.Join(dir, "missing.key"), nil); err == nil {
+		t.Error("NewCertReloader() with a missing key succeeded")
+	}
+}
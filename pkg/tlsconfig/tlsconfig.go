@@ -0,0 +1,136 @@
+// Package tlsconfig builds the TLS configuration of the server with reloadable certificates.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+var (
+	errUnknownVersion     = errors.New("unknown TLS version")
+	errUnknownCipherSuite = errors.New("unknown or insecure cipher suite")
+	errTLS13CipherSuite   = errors.New("the TLS 1.3 cipher suites aren't configurable")
+)
+
+// versions maps the configured names to the TLS versions.
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Options consists of the TLS options of the server.
+type Options struct {
+	// MinVersion is the minimum accepted TLS version: 1.0, 1.1, 1.2 or 1.3, 1.2 if empty.
+	MinVersion string `mapstructure:"minVersion"`
+	// CipherSuites are the names of the accepted TLS 1.2 cipher suites, the Go defaults if empty.
+	// The TLS 1.3 suites aren't configurable, they are rejected.
+	CipherSuites []string `mapstructure:"cipherSuites"`
+}
+
+// NewConfig creates the TLS configuration serving the certificates of the reloader.
+func NewConfig(options Options, reloader *CertReloader) (*tls.Config, error) {
+	minVersion, err := ParseVersion(options.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherSuites, err := ParseCipherSuites(options.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
+
+// ParseVersion returns the TLS version of the name, TLS 1.2 if the name is empty.
+func ParseVersion(name string) (uint16, error) {
+	if name == "" {
+		return tls.VersionTLS12, nil
+	}
+
+	version, ok := versions[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", errUnknownVersion, name)
+	}
+
+	return version, nil
+}
+
+// ParseCipherSuites returns the IDs of the named cipher suites, nil if there are no names.
+// Only the suites Go considers secure are accepted. The TLS 1.3 suites are rejected,
+// since Go ignores them in the config and always enables them all.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	tls13 := make(map[string]bool)
+
+	for _, suite := range tls.CipherSuites() {
+		if tls13Only(suite) {
+			tls13[suite.Name] = true
+
+			continue
+		}
+
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		if tls13[name] {
+			return nil, fmt.Errorf("%w: %q", errTLS13CipherSuite, name)
+		}
+
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errUnknownCipherSuite, name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// tls13Only reports whether the cipher suite is only supported by TLS 1.3.
+func tls13Only(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version != tls.VersionTLS13 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RedirectHandler redirects every request to the same url over HTTPS on the port of the httpsAddress.
+func RedirectHandler(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := "https://" + host + req.URL.RequestURI()
+
+		http.Redirect(w, req, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,103 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    uint16
+		wantErr bool
+	}{
+		{name: "", want: tls.VersionTLS12},
+		{name: "1.0", want: tls.VersionTLS10},
+		{name: "1.2", want: tls.VersionTLS12},
+		{name: "1.3", want: tls.VersionTLS13},
+		{name: "TLS1.3", wantErr: true},
+		{name: "1.4", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseVersion(%q) error = %v, wantErr %t", tt.name, err, tt.wantErr)
+		}
+
+		if err != nil && !errors.Is(err, errUnknownVersion) {
+			t.Errorf("ParseVersion(%q) error = %v, want %v", tt.name, err, errUnknownVersion)
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseVersion(%q) = %#x, want %#x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    []uint16
+		wantErr error
+	}{
+		{name: "defaults", names: nil, want: nil},
+		{
+			name:  "TLS 1.2 suites in order",
+			names: []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			want: []uint16{
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			},
+		},
+		{name: "unknown suite", names: []string{"TLS_MADE_UP"}, wantErr: errUnknownCipherSuite},
+		{name: "insecure suite", names: []string{"TLS_RSA_WITH_RC4_128_SHA"}, wantErr: errUnknownCipherSuite},
+		{
+			name:    "TLS 1.3 suite",
+			names:   []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_AES_128_GCM_SHA256"},
+			wantErr: errTLS13CipherSuite,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCipherSuites(tt.names)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseCipherSuites() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCipherSuites() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsAddress string
+		host         string
+		want         string
+	}{
+		{httpsAddress: ":443", host: "uart.example", want: "https://uart.example/v1/market/1?x=1"},
+		{httpsAddress: ":8443", host: "uart.example:8080", want: "https://uart.example:8443/v1/market/1?x=1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/market/1?x=1", nil)
+		req.Host = tt.host
+
+		recorder := httptest.NewRecorder()
+		RedirectHandler(tt.httpsAddress).ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusPermanentRedirect || recorder.Header().Get("Location") != tt.want {
+			t.Errorf("redirect = %d to %q, want %d to %q", recorder.Code, recorder.Header().Get("Location"),
+				http.StatusPermanentRedirect, tt.want)
+		}
+	}
+}
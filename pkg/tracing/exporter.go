@@ -0,0 +1,367 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+)
+
+// OTLP status codes.
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+const (
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+	defaultExportTimeout = 10 * time.Second
+	queueBatches         = 4
+)
+
+var errExportStatus = errors.New("the collector responded with status")
+
+// NoopExporter drops all the spans.
+type NoopExporter struct{}
+
+// Export drops the span.
+func (NoopExporter) Export(SpanData) {}
+
+// Shutdown does nothing.
+func (NoopExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// StdoutExporter writes every span as a JSON line.
+type StdoutExporter struct {
+	mu     *sync.Mutex
+	output io.Writer
+}
+
+// NewStdoutExporter creates a new instance of the StdoutExporter writing to the output.
+func NewStdoutExporter(output io.Writer) *StdoutExporter {
+	return &StdoutExporter{
+		mu:     new(sync.Mutex),
+		output: output,
+	}
+}
+
+// Export writes the span.
+func (e *StdoutExporter) Export(span SpanData) {
+	encData, err := json.Marshal(toOTLPSpan(span))
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, _ = e.output.Write(append(encData, '\n'))
+}
+
+// Shutdown does nothing, the spans are written immediately.
+func (e *StdoutExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// OTLPConfig consists of the OTLP/HTTP exporter options.
+type OTLPConfig struct {
+	// Endpoint is the url the spans are posted to, usually ending with /v1/traces.
+	Endpoint string
+	// ServiceName is the service.name resource attribute.
+	ServiceName string
+	// BatchSize is the maximum number of spans sent at once.
+	BatchSize int
+	// FlushInterval is the maximum time a span waits in the queue.
+	FlushInterval time.Duration
+	// Timeout of a single export request.
+	Timeout time.Duration
+}
+
+// OTLPExporter sends the spans in batches to a collector with OTLP/HTTP in the JSON encoding.
+type OTLPExporter struct {
+	config     OTLPConfig
+	httpClient *http.Client
+	loggr      *logger.Logger
+	queue      chan SpanData
+	flush      chan chan struct{}
+	stop       chan struct{}
+	wg         *sync.WaitGroup
+}
+
+// NewOTLPExporter creates a new instance of the OTLPExporter and starts the sending loop.
+func NewOTLPExporter(config OTLPConfig, loggr *logger.Logger) *OTLPExporter {
+	if config.BatchSize < 1 {
+		config.BatchSize = defaultBatchSize
+	}
+
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = defaultExportTimeout
+	}
+
+	exporter := &OTLPExporter{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout},
+		loggr:      loggr,
+		queue:      make(chan SpanData, config.BatchSize*queueBatches),
+		flush:      make(chan chan struct{}),
+		stop:       make(chan struct{}),
+		wg:         new(sync.WaitGroup),
+	}
+
+	exporter.wg.Add(1)
+
+	go func() {
+		defer exporter.wg.Done()
+
+		exporter.sendLoop()
+	}()
+
+	return exporter
+}
+
+// Export queues the span, dropping it if the queue is full.
+func (e *OTLPExporter) Export(span SpanData) {
+	select {
+	case e.queue <- span:
+	default:
+	}
+}
+
+// Shutdown sends the queued spans and stops the sending loop.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		close(e.stop)
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("shutting the exporter down: %w", ctx.Err())
+	}
+}
+
+// sendLoop sends the queued spans once a batch is full or the flush interval passes.
+func (e *OTLPExporter) sendLoop() {
+	ticker := time.NewTicker(e.config.FlushInterval)
+
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, e.config.BatchSize)
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+
+			if len(batch) >= e.config.BatchSize {
+				e.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = batch[:0]
+		case <-e.stop:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					e.send(batch)
+
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts the batch to the collector.
+func (e *OTLPExporter) send(batch []SpanData) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := e.post(batch); err != nil {
+		e.loggr.Error("exporting %d spans: %v", len(batch), err)
+	}
+}
+
+// post encodes the batch as an OTLP export request and posts it to the collector.
+func (e *OTLPExporter) post(batch []SpanData) error {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, toOTLPSpan(span))
+	}
+
+	request := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &e.config.ServiceName}}},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: e.config.ServiceName},
+				Spans: spans,
+			}},
+		}},
+	}
+
+	encData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("encoding the spans: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.Timeout)
+
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint, bytes.NewReader(encData))
+	if err != nil {
+		return fmt.Errorf("creating the export request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending the export request: %w", err)
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w %d", errExportStatus, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// otlpRequest is the OTLP trace export request in the JSON encoding.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// toOTLPSpan converts the span to its OTLP JSON representation.
+func toOTLPSpan(span SpanData) otlpSpan {
+	result := otlpSpan{
+		TraceID:           span.TraceID.String(),
+		SpanID:            span.SpanID.String(),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusUnset},
+	}
+
+	if span.ParentSpanID != (SpanID{}) {
+		result.ParentSpanID = span.ParentSpanID.String()
+	}
+
+	if span.Error != "" {
+		result.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+	}
+
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result.Attributes = append(result.Attributes, otlpAttribute{Key: key, Value: toOTLPValue(span.Attributes[key])})
+	}
+
+	return result
+}
+
+// toOTLPValue converts the attribute value to its OTLP JSON representation.
+func toOTLPValue(value any) otlpValue {
+	switch typed := value.(type) {
+	case string:
+		return otlpValue{StringValue: &typed}
+	case int:
+		intValue := strconv.Itoa(typed)
+
+		return otlpValue{IntValue: &intValue}
+	case int64:
+		intValue := strconv.FormatInt(typed, 10)
+
+		return otlpValue{IntValue: &intValue}
+	case float64:
+		return otlpValue{DoubleValue: &typed}
+	case bool:
+		return otlpValue{BoolValue: &typed}
+	default:
+		stringValue := fmt.Sprint(typed)
+
+		return otlpValue{StringValue: &stringValue}
+	}
+}
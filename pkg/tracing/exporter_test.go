@@ -0,0 +1,241 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/logger"
+)
+
+// collector is a test OTLP collector recording the export requests.
+type collector struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []otlpRequest
+	received chan struct{}
+}
+
+// newCollector starts a collector responding to the export requests with the status.
+func newCollector(t *testing.T, status int) *collector {
+	t.Helper()
+
+	c := &collector{received: make(chan struct{}, 16)}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" ||
+			r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected export request %s %s with %q", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		var request otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decoding the export request: %v", err)
+		}
+
+		c.mu.Lock()
+		c.requests = append(c.requests, request)
+		c.mu.Unlock()
+
+		w.WriteHeader(status)
+		c.received <- struct{}{}
+	}))
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+// exports returns the received export requests.
+func (c *collector) exports() []otlpRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]otlpRequest(nil), c.requests...)
+}
+
+// wait waits for an export request.
+func (c *collector) wait(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-c.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export request received")
+	}
+}
+
+// newTestExporter creates an exporter sending to the collector.
+func newTestExporter(c *collector, batchSize int, flushInterval time.Duration, output *bytes.Buffer,
+) *OTLPExporter {
+	return NewOTLPExporter(OTLPConfig{
+		Endpoint:      c.URL + "/v1/traces",
+		ServiceName:   "uart-proxy",
+		BatchSize:     batchSize,
+		FlushInterval: flushInterval,
+		Timeout:       time.Second,
+	}, logger.NewLogger(output, "test"))
+}
+
+// testSpan returns a finished span with the name.
+func testSpan(name string) SpanData {
+	start := time.Unix(1700000000, 0)
+
+	return SpanData{
+		Name:         name,
+		Kind:         KindServer,
+		TraceID:      TraceID{1},
+		SpanID:       SpanID{2},
+		ParentSpanID: SpanID{3},
+		Start:        start,
+		End:          start.Add(time.Second),
+		Attributes:   map[string]any{"http.method": "GET", "http.status_code": 503, "cached": true},
+		Error:        "responded with status 503",
+	}
+}
+
+// spanNames returns the names of the spans of the export request.
+func spanNames(request otlpRequest) []string {
+	var names []string
+
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				names = append(names, span.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+func TestOTLPExporterSendsFullBatches(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	exporter := newTestExporter(c, 2, time.Hour, new(bytes.Buffer))
+
+	exporter.Export(testSpan("a"))
+	exporter.Export(testSpan("b"))
+	c.wait(t)
+
+	exporter.Export(testSpan("c"))
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	exports := c.exports()
+	if len(exports) != 2 {
+		t.Fatalf("received %d export requests, want 2", len(exports))
+	}
+
+	if got := strings.Join(spanNames(exports[0]), ","); got != "a,b" {
+		t.Errorf("first batch spans = %s, want a,b", got)
+	}
+
+	if got := strings.Join(spanNames(exports[1]), ","); got != "c" {
+		t.Errorf("batch sent on shutdown spans = %s, want c", got)
+	}
+}
+
+func TestOTLPExporterFlushesOnInterval(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	exporter := newTestExporter(c, 100, 10*time.Millisecond, new(bytes.Buffer))
+
+	defer func() { _ = exporter.Shutdown(context.Background()) }()
+
+	exporter.Export(testSpan("a"))
+	c.wait(t)
+
+	if got := spanNames(c.exports()[0]); len(got) != 1 || got[0] != "a" {
+		t.Errorf("flushed spans = %v, want [a]", got)
+	}
+}
+
+func TestOTLPExporterEncoding(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	exporter := newTestExporter(c, 1, time.Hour, new(bytes.Buffer))
+
+	exporter.Export(testSpan("GET /market"))
+	c.wait(t)
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	request := c.exports()[0]
+
+	resource := request.ResourceSpans[0].Resource
+	if len(resource.Attributes) != 1 || resource.Attributes[0].Key != "service.name" ||
+		*resource.Attributes[0].Value.StringValue != "uart-proxy" {
+		t.Errorf("resource = %+v, want the service.name attribute", resource)
+	}
+
+	span := request.ResourceSpans[0].ScopeSpans[0].Spans[0]
+
+	checks := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"trace ID", span.TraceID, "01000000000000000000000000000000"},
+		{"span ID", span.SpanID, "0200000000000000"},
+		{"parent span ID", span.ParentSpanID, "0300000000000000"},
+		{"kind", span.Kind, KindServer},
+		{"start", span.StartTimeUnixNano, "1700000000000000000"},
+		{"end", span.EndTimeUnixNano, "1700000001000000000"},
+		{"status code", span.Status.Code, otlpStatusError},
+		{"status message", span.Status.Message, "responded with status 503"},
+		{"attributes", len(span.Attributes), 3},
+		{"bool attribute", *span.Attributes[0].Value.BoolValue, true},
+		{"string attribute", *span.Attributes[1].Value.StringValue, "GET"},
+		{"int attribute", *span.Attributes[2].Value.IntValue, "503"},
+	}
+
+	for _, check := range checks {
+		if check.got != check.want {
+			t.Errorf("%s = %v, want %v", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestOTLPExporterLogsFailedExports(t *testing.T) {
+	c := newCollector(t, http.StatusServiceUnavailable)
+	output := new(bytes.Buffer)
+	exporter := newTestExporter(c, 1, time.Hour, output)
+
+	exporter.Export(testSpan("a"))
+	c.wait(t)
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if !strings.Contains(output.String(), "exporting 1 spans") || !strings.Contains(output.String(), "503") {
+		t.Errorf("log = %q, want the failed export", output.String())
+	}
+}
+
+func TestOTLPExporterShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	defer server.Close()
+	defer close(release)
+
+	exporter := NewOTLPExporter(OTLPConfig{Endpoint: server.URL, BatchSize: 1, Timeout: time.Minute},
+		logger.NewLogger(new(bytes.Buffer), "test"))
+	exporter.Export(testSpan("a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := exporter.Shutdown(ctx); err == nil {
+		t.Error("Shutdown() error = nil, want the deadline exceeded")
+	}
+}
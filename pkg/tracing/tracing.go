@@ -0,0 +1,397 @@
+// Package tracing provides distributed tracing with W3C trace context propagation.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/httpx"
+)
+
+// Headers of the W3C trace context.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const (
+	traceparentVersion = "00"
+	sampledFlag        = 0x01
+	traceIDLength      = 16
+	spanIDLength       = 8
+)
+
+// Kinds of the spans, matching the OTLP values.
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+var errServerStatus = errors.New("responded with status")
+
+// TraceID identifies a trace.
+type TraceID [traceIDLength]byte
+
+// SpanID identifies a span.
+type SpanID [spanIDLength]byte
+
+// String returns the hex representation of the trace ID.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// String returns the hex representation of the span ID.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the part of a span propagated across process boundaries.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// Valid reports whether the span context has non-zero IDs.
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats the span context as the traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return traceparentVersion + "-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses the traceparent header value.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 2*traceIDLength || len(parts[2]) != 2*spanIDLength || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+
+	if parts[0] == traceparentVersion && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	sc.Sampled = flags[0]&sampledFlag != 0
+
+	return sc, sc.Valid()
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	mu         sync.Mutex
+	tracer     *Tracer
+	name       string
+	kind       int
+	context    SpanContext
+	parentID   SpanID
+	start      time.Time
+	end        time.Time
+	attributes map[string]any
+	errMessage string
+	ended      bool
+}
+
+// Context returns the span context of the span.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.context
+}
+
+// SetAttribute sets the attribute of the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// URL returns the url for the http.url attribute with only the scheme, the host and the path,
+// leaving out the query, the fragment and the user info which may carry credentials or codes.
+func URL(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+// RecordError marks the span as failed with the error.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.errMessage = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and hands it to the exporter if it's sampled.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+
+		return
+	}
+
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.context.Sampled {
+		s.tracer.exporter.Export(s.snapshot())
+	}
+}
+
+// snapshot returns the exported data of the span.
+func (s *Span) snapshot() SpanData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attributes := make(map[string]any, len(s.attributes))
+	for key, value := range s.attributes {
+		attributes[key] = value
+	}
+
+	return SpanData{
+		Name:         s.name,
+		Kind:         s.kind,
+		TraceID:      s.context.TraceID,
+		SpanID:       s.context.SpanID,
+		ParentSpanID: s.parentID,
+		Start:        s.start,
+		End:          s.end,
+		Attributes:   attributes,
+		Error:        s.errMessage,
+	}
+}
+
+// SpanData is a finished span handed to the exporter.
+type SpanData struct {
+	Name         string
+	Kind         int
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]any
+	Error        string
+}
+
+// Exporter sends the finished spans to a tracing backend.
+type Exporter interface {
+	// Export queues the span for sending.
+	Export(span SpanData)
+	// Shutdown sends the queued spans and stops the exporter.
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer creates spans and hands the sampled ones to the exporter.
+type Tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+}
+
+// NewTracer creates a new instance of the Tracer sampling the sampleRatio of the new traces.
+func NewTracer(exporter Exporter, sampleRatio float64) *Tracer {
+	return &Tracer{
+		exporter:    exporter,
+		sampleRatio: sampleRatio,
+	}
+}
+
+// Shutdown sends the queued spans and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.exporter.Shutdown(ctx) //nolint:wrapcheck
+}
+
+// contextKey is the type of the context keys of the package.
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+	tracerKey
+)
+
+// WithTracer returns a copy of the context carrying the tracer used by Start.
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey, tracer)
+}
+
+// SpanFromContext returns the current span carried by the context, nil if none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+
+	return span
+}
+
+// Start starts a span as a child of the current or remote span carried by the context.
+// No span is started if the context carries no tracer.
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	tracer, ok := ctx.Value(tracerKey).(*Tracer)
+	if !ok || tracer == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:     tracer,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]any),
+	}
+
+	parent := SpanFromContext(ctx).Context()
+	if !parent.Valid() {
+		parent, _ = ctx.Value(remoteKey).(SpanContext)
+	}
+
+	if parent.Valid() {
+		span.context = SpanContext{
+			TraceID:    parent.TraceID,
+			Sampled:    parent.Sampled,
+			TraceState: parent.TraceState,
+		}
+		span.parentID = parent.SpanID
+	} else {
+		span.context = SpanContext{
+			TraceID: newTraceID(),
+			Sampled: tracer.sample(),
+		}
+	}
+
+	span.context.SpanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// Extract returns a copy of the context carrying the remote span context of the headers.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+
+	sc.TraceState = header.Get(TracestateHeader)
+
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// Inject sets the trace context headers of the current span carried by the context.
+func Inject(ctx context.Context, header http.Header) {
+	sc := SpanFromContext(ctx).Context()
+	if !sc.Valid() {
+		return
+	}
+
+	header.Set(TraceparentHeader, sc.Traceparent())
+
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	} else {
+		header.Del(TracestateHeader)
+	}
+}
+
+// Middleware starts a server span for every request, continuing the trace of the incoming headers.
+func (t *Tracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := Extract(WithTracer(req.Context(), t), req.Header)
+		ctx, span := Start(ctx, req.Method+" "+req.URL.Path, KindServer)
+
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.target", req.URL.Path)
+		span.SetAttribute("http.user_agent", req.UserAgent())
+
+		recorder := httpx.NewRecorder(w)
+
+		defer func() {
+			status := recorder.Status()
+			if status >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("%w %d", errServerStatus, status))
+			}
+
+			span.SetAttribute("http.status_code", status)
+			span.End()
+		}()
+
+		next.ServeHTTP(recorder, req.WithContext(ctx))
+	})
+}
+
+// sample decides whether a new trace is sampled.
+func (t *Tracer) sample() bool {
+	switch {
+	case t.sampleRatio >= 1:
+		return true
+	case t.sampleRatio <= 0:
+		return false
+	}
+
+	var buf [8]byte
+
+	_, _ = rand.Read(buf[:])
+
+	return float64(binary.BigEndian.Uint64(buf[:])>>11)/(1<<53) < t.sampleRatio
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() TraceID {
+	var id TraceID
+
+	_, _ = rand.Read(id[:])
+
+	return id
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() SpanID {
+	var id SpanID
+
+	_, _ = rand.Read(id[:])
+
+	return id
+}
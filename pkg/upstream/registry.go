@@ -0,0 +1,274 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
+	"github.com/UArt-project/UArt-proxy/pkg/metrics"
+)
+
+// TransportConfig consists of the options of the transport shared by the upstreams.
+type TransportConfig struct {
+	// MaxIdleConns is the maximum number of idle connections across all hosts, unlimited if zero.
+	MaxIdleConns int `mapstructure:"maxIdleConns"`
+	// MaxIdleConnsPerHost is the maximum number of idle connections per host.
+	MaxIdleConnsPerHost int `mapstructure:"maxIdleConnsPerHost"`
+	// MaxConnsPerHost is the maximum number of connections per host, unlimited if zero.
+	MaxConnsPerHost int `mapstructure:"maxConnsPerHost"`
+	// IdleConnTimeout is the time an idle connection is kept open.
+	IdleConnTimeout time.Duration `mapstructure:"idleConnTimeout"`
+	// KeepAlive is the interval of the TCP keep-alive probes.
+	KeepAlive time.Duration `mapstructure:"keepAlive"`
+	// DialTimeout is the timeout of establishing a connection.
+	DialTimeout time.Duration `mapstructure:"dialTimeout"`
+	// TLSHandshakeTimeout is the timeout of the TLS handshake.
+	TLSHandshakeTimeout time.Duration `mapstructure:"tlsHandshakeTimeout"`
+	// ResponseHeaderTimeout is the timeout of waiting for the response headers.
+	ResponseHeaderTimeout time.Duration `mapstructure:"responseHeaderTimeout"`
+	// ExpectContinueTimeout is the timeout of waiting for a 100-continue response.
+	ExpectContinueTimeout time.Duration `mapstructure:"expectContinueTimeout"`
+	// HTTP2 enables HTTP/2 for TLS connections.
+	HTTP2 bool `mapstructure:"http2"`
+}
+
+// TransportStats are the connection pool statistics of the shared transport.
+type TransportStats struct {
+	// The number of connections currently open.
+	OpenConnections int64 `json:"openConnections"`
+	// The number of connections dialed.
+	Dials int64 `json:"dials"`
+	// The number of failed dials.
+	DialErrors int64 `json:"dialErrors"`
+	// The connection statistics of the upstreams.
+	Upstreams []ConnectionStats `json:"upstreams"`
+}
+
+// ConnectionStats are the connection statistics of an upstream.
+type ConnectionStats struct {
+	// The name of the upstream.
+	Name string `json:"name"`
+	// The number of requests served by a reused connection.
+	ReusedConnections int64 `json:"reusedConnections"`
+	// The number of requests served by a new connection.
+	NewConnections int64 `json:"newConnections"`
+	// The number of requests served by a connection taken from the idle pool.
+	IdleConnections int64 `json:"idleConnections"`
+}
+
+// connStats counts the connections of an upstream.
+type connStats struct {
+	reused atomic.Int64
+	fresh  atomic.Int64
+	idle   atomic.Int64
+}
+
+// Registry owns the upstreams and the transport they share.
+type Registry struct {
+	mu        *sync.RWMutex
+	transport *http.Transport
+	// The clones of the shared transport with the TLS options of the upstreams.
+	tlsTransports []*http.Transport
+	upstreams     map[string]*Upstream
+	open          atomic.Int64
+	dials         atomic.Int64
+	dialErrs      atomic.Int64
+	metrics       *requestMetrics
+}
+
+// NewRegistry creates a new instance of the Registry with the transport configured.
+func NewRegistry(config TransportConfig) *Registry {
+	registry := &Registry{
+		mu:        new(sync.RWMutex),
+		upstreams: make(map[string]*Upstream),
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   config.DialTimeout,
+		KeepAlive: config.KeepAlive,
+	}
+
+	registry.transport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           registry.dialContext(dialer),
+		ForceAttemptHTTP2:     config.HTTP2,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		ExpectContinueTimeout: config.ExpectContinueTimeout,
+	}
+
+	return registry
+}
+
+// Register creates the upstream with the specified name using the shared transport.
+// An upstream with TLS options gets a clone of the shared transport with the options applied,
+// its connections are still counted in the transport stats.
+func (r *Registry) Register(name string, bal balancer.Balancer, tlsConfig TLSConfig) (*Upstream, error) {
+	transport, err := r.transportFor(tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS of %s: %w", name, err)
+	}
+
+	newUpstream := New(name, bal, transport)
+
+	r.mu.Lock()
+	newUpstream.metrics = r.metrics
+	r.upstreams[name] = newUpstream
+	r.mu.Unlock()
+
+	return newUpstream, nil
+}
+
+// Transport returns the transport with the TLS options for the requests sent outside of the upstreams,
+// e.g. by the proxy routes, so they get the pool limits, the timeouts and the connection stats too.
+func (r *Registry) Transport(tlsConfig TLSConfig) (http.RoundTripper, error) {
+	transport, err := r.transportFor(tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS: %w", err)
+	}
+
+	return transport, nil
+}
+
+// transportFor returns the shared transport, or a clone of it with the TLS options applied if there are any.
+func (r *Registry) transportFor(tlsConfig TLSConfig) (*http.Transport, error) {
+	if !tlsConfig.Enabled() {
+		return r.transport, nil
+	}
+
+	clientConfig, err := tlsConfig.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := r.transport.Clone()
+	transport.TLSClientConfig = clientConfig
+
+	r.mu.Lock()
+	r.tlsTransports = append(r.tlsTransports, transport)
+	r.mu.Unlock()
+
+	return transport, nil
+}
+
+// Instrument registers the upstream and connection pool metrics, it must be called before Register.
+func (r *Registry) Instrument(reg *metrics.Registry) {
+	r.metrics = &requestMetrics{
+		requests: reg.NewCounterVec("uart_proxy_upstream_requests_total",
+			"Number of requests sent to the upstreams by response status.", "upstream", "status"),
+		duration: reg.NewHistogramVec("uart_proxy_upstream_request_duration_seconds",
+			"Duration of the requests sent to the upstreams.", metrics.DefaultBuckets, "upstream"),
+		errors: reg.NewCounterVec("uart_proxy_upstream_request_errors_total",
+			"Number of failed requests sent to the upstreams by error kind.", "upstream", "kind"),
+	}
+
+	reg.NewGaugeFunc("uart_proxy_upstream_open_connections", "Number of open upstream connections.",
+		func() float64 { return float64(r.open.Load()) })
+	reg.NewCounterFunc("uart_proxy_upstream_dials_total", "Number of dialed upstream connections.",
+		func() float64 { return float64(r.dials.Load()) })
+	reg.NewCounterFunc("uart_proxy_upstream_dial_errors_total", "Number of failed upstream dials.",
+		func() float64 { return float64(r.dialErrs.Load()) })
+}
+
+// Get returns the upstream with the specified name.
+func (r *Registry) Get(name string) (*Upstream, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.upstreams[name]
+
+	return u, ok
+}
+
+// Upstreams returns all the upstreams sorted by name.
+func (r *Registry) Upstreams() []*Upstream {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	upstreams := make([]*Upstream, 0, len(r.upstreams))
+	for _, u := range r.upstreams {
+		upstreams = append(upstreams, u)
+	}
+
+	sort.Slice(upstreams, func(i, j int) bool {
+		return upstreams[i].name < upstreams[j].name
+	})
+
+	return upstreams
+}
+
+// Stats returns the connection pool statistics of the shared transport.
+func (r *Registry) Stats() TransportStats {
+	stats := TransportStats{
+		OpenConnections: r.open.Load(),
+		Dials:           r.dials.Load(),
+		DialErrors:      r.dialErrs.Load(),
+	}
+
+	for _, u := range r.Upstreams() {
+		stats.Upstreams = append(stats.Upstreams, ConnectionStats{
+			Name:              u.name,
+			ReusedConnections: u.connStats.reused.Load(),
+			NewConnections:    u.connStats.fresh.Load(),
+			IdleConnections:   u.connStats.idle.Load(),
+		})
+	}
+
+	return stats
+}
+
+// CloseIdleConnections closes the idle connections of the shared transport and its clones.
+func (r *Registry) CloseIdleConnections() {
+	r.transport.CloseIdleConnections()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, transport := range r.tlsTransports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// dialContext returns a dial function counting the connections of the transport.
+func (r *Registry) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		r.dials.Add(1)
+
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			r.dialErrs.Add(1)
+
+			return nil, fmt.Errorf("dialing %s: %w", addr, err)
+		}
+
+		r.open.Add(1)
+
+		return &countedConn{Conn: conn, open: &r.open}, nil
+	}
+}
+
+// countedConn decrements the number of open connections once closed.
+type countedConn struct {
+	net.Conn
+	open *atomic.Int64
+	once sync.Once
+}
+
+// Close closes the connection.
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		c.open.Add(-1)
+	})
+
+	return c.Conn.Close() //nolint:wrapcheck
+}
@@ -0,0 +1,114 @@
+package upstream
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	errNoCACerts         = errors.New("no certificates found in the CA bundle")
+	errIncompleteKeyPair = errors.New("both the client certificate and key must be set")
+	errInvalidPin        = errors.New("the pin isn't a base64 encoded SHA-256 digest")
+	errPinMismatch       = errors.New("no certificate of the chain matches the pinned keys")
+)
+
+// TLSConfig consists of the TLS options of the connections to an upstream.
+// The targets of the upstream must use the https scheme for the options to apply.
+type TLSConfig struct {
+	// CAFile is the PEM bundle of the CAs verifying the upstream, the system pool if empty.
+	CAFile string `mapstructure:"caFile"`
+	// CertFile and KeyFile are the PEM encoded client certificate and key presented for mutual TLS.
+	CertFile string `mapstructure:"certFile"`
+	KeyFile  string `mapstructure:"keyFile"`
+	// ServerName overrides the name used for SNI and the verification of the upstream certificate.
+	ServerName string `mapstructure:"serverName"`
+	// PinnedKeys are the base64 encoded SHA-256 digests of the subject public key infos,
+	// one of them must match a certificate of the upstream chain.
+	PinnedKeys []string `mapstructure:"pinnedKeys"`
+}
+
+// Enabled reports whether any of the options is set.
+func (c TLSConfig) Enabled() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.KeyFile != "" || c.ServerName != "" || len(c.PinnedKeys) > 0
+}
+
+// Validate checks that the files can be loaded and the pins are well-formed.
+func (c TLSConfig) Validate() error {
+	_, err := c.clientConfig()
+
+	return err
+}
+
+// clientConfig creates the TLS configuration of the client.
+func (c TLSConfig) clientConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		pemData, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("%w %s", errNoCACerts, c.CAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errIncompleteKeyPair
+		}
+
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading the client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.PinnedKeys) > 0 {
+		pins := make(map[[sha256.Size]byte]struct{}, len(c.PinnedKeys))
+
+		for _, pin := range c.PinnedKeys {
+			digest, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf("%w: %q", errInvalidPin, pin)
+			}
+
+			pins[*(*[sha256.Size]byte)(digest)] = struct{}{}
+		}
+
+		tlsConfig.VerifyConnection = verifyPins(pins)
+	}
+
+	return tlsConfig, nil
+}
+
+// verifyPins returns a connection check requiring a certificate of a verified chain to match one of the pins.
+// It runs after the regular chain verification, so the verified chains include the CA the peer didn't send,
+// while the extra certificates the peer sent outside of the chains never satisfy a pin.
+func verifyPins(pins map[[sha256.Size]byte]struct{}) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		for _, chain := range state.VerifiedChains {
+			for _, cert := range chain {
+				if _, ok := pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)]; ok {
+					return nil
+				}
+			}
+		}
+
+		return errPinMismatch
+	}
+}
@@ -0,0 +1,341 @@
+package upstream
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key, written to PEM files.
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// pin returns the pin of the public key of the certificate.
+func (c *testCert) pin() string {
+	digest := sha256.Sum256(c.cert.RawSubjectPublicKeyInfo)
+
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// tlsCertificate returns the certificate for a TLS config.
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// newTestCert creates a certificate from the template signed by the parent, self-signed if nil,
+// and writes it to the directory.
+func newTestCert(t *testing.T, dir, name string, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating the key of %s: %v", name, err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerCert := key, template
+	if parent != nil {
+		signer, signerCert = parent.key, parent.cert
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("creating the certificate %s: %v", name, err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing the certificate %s: %v", name, err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("encoding the key of %s: %v", name, err)
+	}
+
+	result := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+
+	writePEM(t, result.certFile, "CERTIFICATE", der)
+	writePEM(t, result.keyFile, "EC PRIVATE KEY", keyDER)
+
+	return result
+}
+
+// writePEM writes the PEM block to the file.
+func writePEM(t *testing.T, file, blockType string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", file, err)
+	}
+}
+
+// testPKI is a CA with the server and client certificates it issued.
+type testPKI struct {
+	dir    string
+	ca     *testCert
+	server *testCert
+	client *testCert
+}
+
+// newTestPKI creates a CA issuing the server certificate for market.internal and 127.0.0.1 and a client certificate.
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	ca := newTestCert(t, dir, "ca", &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, nil)
+
+	return &testPKI{
+		dir: dir,
+		ca:  ca,
+		server: newTestCert(t, dir, "server", &x509.Certificate{
+			DNSNames:    []string{"market.internal"},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, ca),
+		client: newTestCert(t, dir, "client", &x509.Certificate{
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, ca),
+	}
+}
+
+// newMTLSServer starts a server requiring a client certificate issued by the CA,
+// sending the extra certificates after its own.
+func newMTLSServer(t *testing.T, pki *testPKI, extra ...*testCert) *httptest.Server {
+	t.Helper()
+
+	serverCert := pki.server.tlsCertificate()
+	for _, cert := range extra {
+		serverCert.Certificate = append(serverCert.Certificate, cert.cert.Raw)
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(pki.ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	// The rejected handshakes are expected.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestTLSConnections(t *testing.T) {
+	pki := newTestPKI(t)
+	other := newTestCert(t, pki.dir, "other", &x509.Certificate{}, nil)
+	server := newMTLSServer(t, pki)
+	// The server sending a certificate with the other key which isn't part of its verified chain.
+	padded := newMTLSServer(t, pki, other)
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		padded  bool
+		wantErr bool
+		errIs   error
+	}{
+		{
+			name:   "mutual TLS",
+			config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile, KeyFile: pki.client.keyFile},
+		},
+		{
+			name:    "no client certificate",
+			config:  TLSConfig{CAFile: pki.ca.certFile},
+			wantErr: true,
+		},
+		{
+			name:    "upstream not verified by the system pool",
+			config:  TLSConfig{CertFile: pki.client.certFile, KeyFile: pki.client.keyFile},
+			wantErr: true,
+		},
+		{
+			name: "server name override",
+			config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile, KeyFile: pki.client.keyFile,
+				ServerName: "market.internal"},
+		},
+		{
+			name: "server name not in the certificate",
+			config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile, KeyFile: pki.client.keyFile,
+				ServerName: "auth.internal"},
+			wantErr: true,
+		},
+		{
+			name: "pinned leaf key",
+			config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile, KeyFile: pki.client.keyFile,
+				PinnedKeys: []string{other.pin(), pki.server.pin()}},
+		},
+		{
+			name: "pinned CA key",
+			config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile, KeyFile: pki.client.keyFile,
+				PinnedKeys: []string{pki.ca.pin()}},
+		},
+		{
+			name: "no pinned key in the chain",
+			config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile, KeyFile: pki.client.keyFile,
+				PinnedKeys: []string{other.pin()}},
+			wantErr: true,
+			errIs:   errPinMismatch,
+		},
+		{
+			name: "pinned key sent outside of the verified chain",
+			config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile, KeyFile: pki.client.keyFile,
+				PinnedKeys: []string{other.pin()}},
+			padded:  true,
+			wantErr: true,
+			errIs:   errPinMismatch,
+		},
+		{
+			name: "pinned leaf key with extra certificates sent",
+			config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile, KeyFile: pki.client.keyFile,
+				PinnedKeys: []string{pki.server.pin()}},
+			padded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(TransportConfig{})
+			defer registry.CloseIdleConnections()
+
+			transport, err := registry.Transport(tt.config)
+			if err != nil {
+				t.Fatalf("Transport() error = %v", err)
+			}
+
+			target := server
+			if tt.padded {
+				target = padded
+			}
+
+			resp, err := (&http.Client{Transport: transport}).Get(target.URL)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("request error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+				t.Errorf("request error = %v, want %v", err, tt.errIs)
+			}
+
+			if err == nil && resp.StatusCode != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+			}
+		})
+	}
+}
+
+func TestTLSTransportSharing(t *testing.T) {
+	pki := newTestPKI(t)
+	registry := NewRegistry(TransportConfig{})
+
+	plain, err := registry.Transport(TLSConfig{})
+	if err != nil {
+		t.Fatalf("Transport() error = %v", err)
+	}
+
+	if plain != registry.transport {
+		t.Error("Transport() without TLS options isn't the shared transport")
+	}
+
+	secure, err := registry.Transport(TLSConfig{CAFile: pki.ca.certFile})
+	if err != nil {
+		t.Fatalf("Transport() error = %v", err)
+	}
+
+	if secure == registry.transport || len(registry.tlsTransports) != 1 {
+		t.Error("Transport() with TLS options isn't a clone kept by the registry")
+	}
+}
+
+func TestTLSConfigValidate(t *testing.T) {
+	pki := newTestPKI(t)
+
+	emptyBundle := filepath.Join(pki.dir, "empty.pem")
+	if err := os.WriteFile(emptyBundle, []byte("no certificates"), 0o600); err != nil {
+		t.Fatalf("writing the bundle: %v", err)
+	}
+
+	shortPin := base64.StdEncoding.EncodeToString([]byte("short"))
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		wantErr error
+	}{
+		{name: "empty", config: TLSConfig{}},
+		{name: "complete", config: TLSConfig{CAFile: pki.ca.certFile, CertFile: pki.client.certFile,
+			KeyFile: pki.client.keyFile, PinnedKeys: []string{pki.ca.pin()}}},
+		{name: "missing CA bundle", config: TLSConfig{CAFile: filepath.Join(pki.dir, "missing.pem")},
+			wantErr: os.ErrNotExist},
+		{name: "CA bundle without certificates", config: TLSConfig{CAFile: emptyBundle}, wantErr: errNoCACerts},
+		{name: "certificate without key", config: TLSConfig{CertFile: pki.client.certFile},
+			wantErr: errIncompleteKeyPair},
+		{name: "key without certificate", config: TLSConfig{KeyFile: pki.client.keyFile},
+			wantErr: errIncompleteKeyPair},
+		{name: "pin not base64", config: TLSConfig{PinnedKeys: []string{"not base64!"}}, wantErr: errInvalidPin},
+		{name: "pin not a SHA-256 digest", config: TLSConfig{PinnedKeys: []string{shortPin}}, wantErr: errInvalidPin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+// Package upstream provides load balanced access to upstream services.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
+	"github.com/UArt-project/UArt-proxy/pkg/metrics"
+	"github.com/UArt-project/UArt-proxy/pkg/requestctx"
+	"github.com/UArt-project/UArt-proxy/pkg/requestid"
+	"github.com/UArt-project/UArt-proxy/pkg/retry"
+	"github.com/UArt-project/UArt-proxy/pkg/tracing"
+)
+
+var (
+	errProbeStatus    = errors.New("the probe failed with status")
+	errResponseStatus = errors.New("the upstream responded with status")
+)
+
+// Upstream is an upstream service served by one or more targets.
+type Upstream struct {
+	// The name of the upstream.
+	name string
+	// The balancer selecting targets, replaced with SetBalancer.
+	balancer balancer.Balancer
+	// Guards the balancer.
+	balancerMu *sync.RWMutex
+	// The http client, redirects are returned to the caller instead of being followed.
+	httpClient *http.Client
+	// The observer notified about the result of every request.
+	observer Observer
+	// The retry policy of idempotent requests.
+	retryPolicy retry.Policy
+	// The connection statistics.
+	connStats *connStats
+	// The request metrics, nil if not instrumented.
+	metrics *requestMetrics
+}
+
+// requestMetrics are the metrics of the upstream requests.
+type requestMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+}
+
+// Observer is notified about the result of every request sent to a target.
+type Observer interface {
+	// Observe records whether the request to the target failed.
+	Observe(target *balancer.Target, failed bool)
+}
+
+// New creates a new instance of the Upstream sending requests through the transport.
+func New(name string, bal balancer.Balancer, transport http.RoundTripper) *Upstream {
+	return &Upstream{
+		name:       name,
+		balancer:   bal,
+		balancerMu: new(sync.RWMutex),
+		httpClient: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		connStats: new(connStats),
+	}
+}
+
+// Name returns the name of the upstream.
+func (u *Upstream) Name() string {
+	return u.name
+}
+
+// Balancer returns the balancer of the upstream.
+func (u *Upstream) Balancer() balancer.Balancer {
+	u.balancerMu.RLock()
+	defer u.balancerMu.RUnlock()
+
+	return u.balancer
+}
+
+// SetBalancer replaces the balancer of the upstream, the requests in flight keep their targets.
+func (u *Upstream) SetBalancer(bal balancer.Balancer) {
+	u.balancerMu.Lock()
+	u.balancer = bal
+	u.balancerMu.Unlock()
+}
+
+// SetObserver sets the observer notified about the result of every request.
+func (u *Upstream) SetObserver(observer Observer) {
+	u.observer = observer
+}
+
+// SetRetryPolicy sets the retry policy of idempotent requests.
+func (u *Upstream) SetRetryPolicy(policy retry.Policy) {
+	u.retryPolicy = policy
+}
+
+// Next returns the target for the next request.
+func (u *Upstream) Next() (*balancer.Target, error) {
+	target, err := u.Balancer().Next()
+	if err != nil {
+		return nil, errdomain.New(errdomain.ErrUpstreamUnavailable,
+			fmt.Errorf("selecting a target of %s: %w", u.name, err))
+	}
+
+	return target, nil
+}
+
+// Do sends a request with the path relative to the target selected by the balancer.
+// Idempotent requests are retried according to the retry policy on another target if there is one,
+// as long as the backoff fits into the deadline of the context.
+func (u *Upstream) Do(ctx context.Context, method, path string, header http.Header) (*http.Response, error) {
+	maxAttempts := 1
+	if retry.Idempotent(method) && u.retryPolicy.Enabled() {
+		maxAttempts = u.retryPolicy.MaxAttempts
+	}
+
+	var previous *balancer.Target
+
+	for attempt := 1; ; attempt++ {
+		target, err := u.nextExcluding(previous)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := u.DoTarget(ctx, target, method, path, header)
+		if attempt >= maxAttempts || !u.retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		// Free the connection and the target of the failed attempt before the backoff,
+		// the attempt is reported by its error if no retry follows.
+		if resp != nil {
+			if err = StatusError(resp); err == nil {
+				err = errdomain.New(errdomain.ErrUnexpectedResponse,
+					fmt.Errorf("%w %d", errResponseStatus, resp.StatusCode))
+			}
+
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		if waitErr := u.retryPolicy.Wait(ctx, attempt); waitErr != nil {
+			return nil, err
+		}
+
+		previous = target
+	}
+}
+
+// nextExcluding returns the target for the next request, another one than the excluded target if the balancer
+// picks one within as many tries as it has targets.
+func (u *Upstream) nextExcluding(excluded *balancer.Target) (*balancer.Target, error) {
+	target, err := u.Next()
+	if err != nil || excluded == nil {
+		return target, err
+	}
+
+	for tries := len(u.Balancer().Targets()) - 1; tries > 0 && target == excluded; tries-- {
+		if target, err = u.Next(); err != nil {
+			return nil, err
+		}
+	}
+
+	return target, nil
+}
+
+// retryable reports whether the result of a request is worth retrying.
+func (u *Upstream) retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return u.retryPolicy.RetryableError(ctx, err)
+	}
+
+	return u.retryPolicy.RetryableStatus(resp.StatusCode)
+}
+
+// DoTarget sends a request with the path relative to the specified target.
+func (u *Upstream) DoTarget(ctx context.Context, target *balancer.Target, method, path string,
+	header http.Header,
+) (*http.Response, error) {
+	reqURL := strings.TrimSuffix(target.URL.String(), "/") + path
+
+	ctx, span := tracing.Start(ctx, u.name+" "+method, tracing.KindClient)
+	defer span.End()
+
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("upstream.name", u.name)
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, u.clientTrace()), method, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request to %s: %w", u.name, err)
+	}
+
+	span.SetAttribute("http.url", tracing.URL(req.URL))
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if requestID := requestctx.RequestID(ctx); requestID != "" && req.Header.Get(requestid.Header) == "" {
+		req.Header.Set(requestid.Header, requestID)
+	}
+
+	tracing.Inject(ctx, req.Header)
+
+	target.Acquire()
+
+	start := time.Now()
+	resp, err := u.httpClient.Do(req)
+	latency := time.Since(start)
+
+	requestctx.AddUpstreamLatency(ctx, latency)
+	u.record(latency, resp, err)
+
+	// A request cancelled by the caller says nothing about the health of the target.
+	if err == nil || !errdomain.IsCanceled(ctx, err) {
+		u.observe(target, err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	}
+
+	if err != nil {
+		target.Release()
+
+		// The client error quotes the full url, keep the query out of the logs and the spans.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = tracing.URL(req.URL)
+		}
+
+		err = errdomain.New(transportErrorKind(err), fmt.Errorf("sending request to %s: %w", u.name, err))
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	span.SetAttribute("http.status_code", resp.StatusCode)
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.RecordError(StatusError(resp))
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, target: target}
+
+	return resp, nil
+}
+
+// StatusError returns the error matching the status of the upstream response, nil if it succeeded.
+func StatusError(resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	err := fmt.Errorf("%w %d", errResponseStatus, resp.StatusCode)
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest:
+		return errdomain.New(errdomain.ErrBadRequest, err)
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errdomain.New(errdomain.ErrUnauthorized, err)
+	case resp.StatusCode == http.StatusForbidden:
+		return errdomain.New(errdomain.ErrForbidden, err)
+	case resp.StatusCode == http.StatusNotFound:
+		return errdomain.New(errdomain.ErrNotFound, err)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return errdomain.NewRetryAfter(errdomain.ErrRateLimited, err,
+			parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+	case resp.StatusCode == http.StatusGatewayTimeout:
+		return errdomain.New(errdomain.ErrTimeout, err)
+	case resp.StatusCode < http.StatusInternalServerError:
+		// The other client errors mean the proxy sent a request the upstream doesn't accept, not the client.
+		return errdomain.New(errdomain.ErrUnexpectedResponse, err)
+	default:
+		return errdomain.New(errdomain.ErrUpstreamUnavailable, err)
+	}
+}
+
+// parseRetryAfter returns the delay of the Retry-After header value, in seconds or an HTTP date,
+// zero if it's missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+
+	return date.Sub(now)
+}
+
+// transportErrorKind returns the kind of the error of a failed request.
+func transportErrorKind(err error) error {
+	var netErr net.Error
+
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return errdomain.ErrTimeout
+	}
+
+	return errdomain.ErrUpstreamUnavailable
+}
+
+// Probe checks whether the target responds on the path.
+// Any response below 500 means the target is alive, probes are not reported to the observer.
+func (u *Upstream) Probe(ctx context.Context, target *balancer.Target, path string) error {
+	reqURL := strings.TrimSuffix(target.URL.String(), "/") + path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating the probe request: %w", err)
+	}
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending the probe request: %w", err)
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	err = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("closing the probe response body: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %d", errProbeStatus, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// clientTrace returns the trace counting the connections used by the upstream.
+func (u *Upstream) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				u.connStats.reused.Add(1)
+			} else {
+				u.connStats.fresh.Add(1)
+			}
+
+			if info.WasIdle {
+				u.connStats.idle.Add(1)
+			}
+		},
+	}
+}
+
+// record updates the request metrics with the result of a request.
+func (u *Upstream) record(latency time.Duration, resp *http.Response, err error) {
+	if u.metrics == nil {
+		return
+	}
+
+	u.metrics.duration.Observe(latency.Seconds(), u.name)
+
+	switch {
+	case err != nil:
+		kind := "unavailable"
+		if errors.Is(transportErrorKind(err), errdomain.ErrTimeout) {
+			kind = "timeout"
+		}
+
+		u.metrics.requests.Inc(u.name, "error")
+		u.metrics.errors.Inc(u.name, kind)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		u.metrics.requests.Inc(u.name, strconv.Itoa(resp.StatusCode))
+		u.metrics.errors.Inc(u.name, "status")
+	default:
+		u.metrics.requests.Inc(u.name, strconv.Itoa(resp.StatusCode))
+	}
+}
+
+// observe notifies the observer about the result of a request.
+func (u *Upstream) observe(target *balancer.Target, failed bool) {
+	if u.observer != nil {
+		u.observer.Observe(target, failed)
+	}
+}
+
+// releasingBody releases the target once the response body is closed,
+// so the request is counted as outstanding until it is fully consumed.
+type releasingBody struct {
+	io.ReadCloser
+	target *balancer.Target
+	once   sync.Once
+}
+
+// Close closes the body and releases the target.
+func (b *releasingBody) Close() error {
+	b.once.Do(b.target.Release)
+
+	if err := b.ReadCloser.Close(); err != nil {
+		return fmt.Errorf("closing the response body: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/UArt-project/UArt-proxy/domain/errdomain"
+	"github.com/UArt-project/UArt-proxy/pkg/balancer"
+	"github.com/UArt-project/UArt-proxy/pkg/retry"
+)
+
+// testServer is a target counting the requests it responds to with the status.
+type testServer struct {
+	*httptest.Server
+	hits atomic.Int64
+}
+
+// newTestServer starts a target responding with the status.
+func newTestServer(t *testing.T, status int) *testServer {
+	t.Helper()
+
+	server := new(testServer)
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newTestUpstream creates an upstream of the servers with the weights, picked with the weighted strategy.
+func newTestUpstream(t *testing.T, policy retry.Policy, weights map[*testServer]int,
+	servers ...*testServer,
+) (*Upstream, []*balancer.Target) {
+	t.Helper()
+
+	targets := make([]*balancer.Target, 0, len(servers))
+
+	for _, server := range servers {
+		target, err := balancer.NewTarget(server.URL, weights[server])
+		if err != nil {
+			t.Fatalf("creating the target: %v", err)
+		}
+
+		targets = append(targets, target)
+	}
+
+	bal, err := balancer.New(balancer.Weighted, targets)
+	if err != nil {
+		t.Fatalf("creating the balancer: %v", err)
+	}
+
+	up := New("test", bal, http.DefaultTransport)
+	up.SetRetryPolicy(policy)
+
+	return up, targets
+}
+
+func TestDoRetries(t *testing.T) {
+	policy := retry.Policy{
+		MaxAttempts:          3,
+		BackoffBase:          time.Millisecond,
+		BackoffCap:           time.Millisecond,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		policy        retry.Policy
+		healthyTarget bool
+		wantStatus    int
+		wantFailing   int64
+		wantHealthy   int64
+	}{
+		{
+			name:          "retried on another target",
+			method:        http.MethodGet,
+			policy:        policy,
+			healthyTarget: true,
+			wantStatus:    http.StatusOK,
+			wantFailing:   1,
+			wantHealthy:   1,
+		},
+		{
+			name:          "non idempotent request not retried",
+			method:        http.MethodPost,
+			policy:        policy,
+			healthyTarget: true,
+			wantStatus:    http.StatusServiceUnavailable,
+			wantFailing:   1,
+		},
+		{
+			name:          "retries disabled",
+			method:        http.MethodGet,
+			policy:        retry.Policy{},
+			healthyTarget: true,
+			wantStatus:    http.StatusServiceUnavailable,
+			wantFailing:   1,
+		},
+		{
+			name:        "last failed attempt returned",
+			method:      http.MethodGet,
+			policy:      policy,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantFailing: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing := newTestServer(t, http.StatusServiceUnavailable)
+			servers := []*testServer{failing}
+
+			// The weights make the balancer pick the failing target twice in a row unless it's excluded.
+			weights := map[*testServer]int{failing: 3}
+
+			healthy := newTestServer(t, http.StatusOK)
+			if tt.healthyTarget {
+				servers = append(servers, healthy)
+				weights[healthy] = 1
+			}
+
+			up, targets := newTestUpstream(t, tt.policy, weights, servers...)
+
+			resp, err := up.Do(context.Background(), tt.method, "/", nil)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Do() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			if got := failing.hits.Load(); got != tt.wantFailing {
+				t.Errorf("failing target hits = %d, want %d", got, tt.wantFailing)
+			}
+
+			if got := healthy.hits.Load(); got != tt.wantHealthy {
+				t.Errorf("healthy target hits = %d, want %d", got, tt.wantHealthy)
+			}
+
+			for _, target := range targets {
+				if outstanding := target.Outstanding(); outstanding != 0 {
+					t.Errorf("target %s has %d outstanding requests, want 0", target.URL, outstanding)
+				}
+			}
+		})
+	}
+}
+
+func TestDoBackoffPastTheDeadline(t *testing.T) {
+	failing := newTestServer(t, http.StatusServiceUnavailable)
+
+	up, targets := newTestUpstream(t, retry.Policy{
+		MaxAttempts:          3,
+		BackoffBase:          time.Second,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}, nil, failing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	resp, err := up.Do(ctx, http.MethodGet, "/", nil)
+	if resp != nil {
+		_ = resp.Body.Close()
+
+		t.Fatalf("Do() returned a response with status %d, want none", resp.StatusCode)
+	}
+
+	// The error of the last attempt is returned rather than the exceeded budget.
+	if !errors.Is(err, errdomain.ErrUpstreamUnavailable) {
+		t.Errorf("Do() error = %v, want %v", err, errdomain.ErrUpstreamUnavailable)
+	}
+
+	if got := failing.hits.Load(); got != 1 {
+		t.Errorf("target hits = %d, want 1", got)
+	}
+
+	if outstanding := targets[0].Outstanding(); outstanding != 0 {
+		t.Errorf("target has %d outstanding requests, want 0", outstanding)
+	}
+}
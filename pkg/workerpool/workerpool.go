@@ -1,11 +1,18 @@
 // Package workerpool provides a workerpool for concurrent task handling.
 package workerpool
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 // WorkerPool provides functionality of running multiple tasks in separate routines.
 type WorkerPool struct {
 	workerNumber int
 	taskChan     chan func()
 	stopChan     chan struct{}
+	busy         *atomic.Int64
+	wg           *sync.WaitGroup
 }
 
 // NewPool returns new instance of a workerpool.
@@ -21,19 +28,27 @@ func NewPool(workerNumber int) *WorkerPool {
 		workerNumber: workerNumber,
 		taskChan:     taskChan,
 		stopChan:     stopChan,
+		busy:         new(atomic.Int64),
+		wg:           new(sync.WaitGroup),
 	}
 }
 
 // Start runs workerpool and makes it available for task handling.
 func (p *WorkerPool) Start() {
+	p.wg.Add(p.workerNumber)
+
 	for i := 0; i < p.workerNumber; i++ {
 		go func() {
+			defer p.wg.Done()
+
 			for {
 				select {
 				case <-p.stopChan:
-					break
+					return
 				case task := <-p.taskChan:
+					p.busy.Add(1)
 					task()
+					p.busy.Add(-1)
 				}
 			}
 		}()
@@ -45,7 +60,20 @@ func (p *WorkerPool) AddTask(task func()) {
 	p.taskChan <- task
 }
 
-// Stop shuts workers down.
+// QueueDepth returns the number of tasks waiting for a worker.
+func (p *WorkerPool) QueueDepth() int {
+	return len(p.taskChan)
+}
+
+// Busy returns the number of workers running a task.
+func (p *WorkerPool) Busy() int {
+	return int(p.busy.Load())
+}
+
+// Stop shuts workers down and waits for the running tasks to complete.
+// The tasks still waiting in the queue are dropped.
 func (p *WorkerPool) Stop() {
 	close(p.stopChan)
+
+	p.wg.Wait()
 }
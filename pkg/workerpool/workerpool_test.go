@@ -0,0 +1,56 @@
+package workerpool
+
+import (
+	"testing"
+	"time"
+)
+
+// waitFor polls the condition until it holds or the test times out.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueueDepthAndBusy(t *testing.T) {
+	pool := NewPool(2)
+	pool.Start()
+
+	release := make(chan struct{})
+	done := make(chan struct{}, 3)
+
+	for i := 0; i < 3; i++ {
+		pool.AddTask(func() {
+			<-release
+			done <- struct{}{}
+		})
+	}
+
+	waitFor(t, "both workers busy", func() bool { return pool.Busy() == 2 })
+
+	if got := pool.QueueDepth(); got != 1 {
+		t.Errorf("QueueDepth() = %d, want 1", got)
+	}
+
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	waitFor(t, "the workers idle", func() bool { return pool.Busy() == 0 })
+
+	if got := pool.QueueDepth(); got != 0 {
+		t.Errorf("QueueDepth() = %d, want 0", got)
+	}
+
+	pool.Stop()
+}